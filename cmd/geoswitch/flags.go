@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+)
+
+// options holds the command-line configuration for GeoSwitch.
+// Every flag falls back to a GEOSWITCH_* environment variable when not set.
+type options struct {
+	configPath   string
+	listenAddr   string
+	exitHeader   string
+	exitParam    string
+	targetParam  string
+	hostDomain   string
+	gluetunImage string
+	ownerID      string
+	ipEchoURL    string
+
+	reloadInterval time.Duration
+
+	adminListenAddr string
+}
+
+func parseFlags() options {
+	var opts options
+
+	flag.StringVar(&opts.configPath, "config", envOrDefault("GEOSWITCH_CONFIG", "config.yaml"),
+		"path to the YAML exits configuration (env GEOSWITCH_CONFIG)")
+	flag.StringVar(&opts.listenAddr, "listen", envOrDefault("GEOSWITCH_LISTEN", ":8080"),
+		"address the proxy listens on (env GEOSWITCH_LISTEN)")
+	flag.StringVar(&opts.exitHeader, "exit-header", envOrDefault("GEOSWITCH_EXIT_HEADER", "X-GeoSwitch-Exit"),
+		"request header used to select an exit (env GEOSWITCH_EXIT_HEADER)")
+	flag.StringVar(&opts.exitParam, "exit-param", envOrDefault("GEOSWITCH_EXIT_PARAM", "gs_exit"),
+		"query parameter and cookie used to select an exit (env GEOSWITCH_EXIT_PARAM)")
+	flag.StringVar(&opts.targetParam, "target-param", envOrDefault("GEOSWITCH_TARGET_PARAM", "gs_target"),
+		"query parameter holding the target URL (env GEOSWITCH_TARGET_PARAM)")
+	flag.StringVar(&opts.hostDomain, "host-domain", envOrDefault("GEOSWITCH_HOST_DOMAIN", ""),
+		"wildcard domain whose subdomains select the exit and target, e.g. geoswitch.local; empty to disable (env GEOSWITCH_HOST_DOMAIN)")
+	flag.StringVar(&opts.gluetunImage, "gluetun-image", envOrDefault("GEOSWITCH_GLUETUN_IMAGE", "qmcgaw/gluetun:v3.41.0"),
+		"Gluetun image used for VPN exits (env GEOSWITCH_GLUETUN_IMAGE)")
+	flag.StringVar(&opts.ownerID, "owner-id", envOrDefault("GEOSWITCH_OWNER_ID", "geoswitch"),
+		"owner label of the Gluetun containers this instance manages (env GEOSWITCH_OWNER_ID)")
+	flag.StringVar(&opts.ipEchoURL, "ip-echo-url", envOrDefault("GEOSWITCH_IP_ECHO_URL", ""),
+		"service reporting the public IP and country of Gluetun exits, empty to disable (env GEOSWITCH_IP_ECHO_URL)")
+	flag.DurationVar(&opts.reloadInterval, "reload-interval", durationEnvOrDefault("GEOSWITCH_RELOAD_INTERVAL", 5*time.Second),
+		"how often the config file is checked for changes, 0 to reload only on SIGHUP (env GEOSWITCH_RELOAD_INTERVAL)")
+	flag.StringVar(&opts.adminListenAddr, "admin-listen", envOrDefault("GEOSWITCH_ADMIN_LISTEN", "127.0.0.1:8081"),
+		"address the admin API listens on, empty to disable; it is unauthenticated, so keep it off untrusted networks (env GEOSWITCH_ADMIN_LISTEN)")
+
+	flag.Parse()
+	return opts
+}
+
+// envOrDefault returns the value of the environment variable key, or fallback if it is unset or empty.
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// durationEnvOrDefault parses the environment variable key as a duration,
+// returning fallback if it is unset or invalid.
+func durationEnvOrDefault(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("[main] ignoring invalid %s=%q: %v", key, v, err)
+		return fallback
+	}
+	return d
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -9,6 +10,7 @@ import (
 	"syscall"
 	"time"
 
+	"geoswitch/internal/admin"
 	"geoswitch/internal/config"
 	"geoswitch/internal/handler"
 	"geoswitch/internal/provider"
@@ -17,36 +19,24 @@ import (
 func main() {
 	log.Println("[main] initialising GeoSwitch")
 
-	cfg := &config.Config{
-		DefaultExit: "kr",
-		Exits: map[string]config.ExitConfig{
-			"kr": {
-				Provider: "gluetun",
-				Country:  "Korea",
-			},
-			"uk": {
-				Provider: "gluetun",
-				Country:  "United Kingdom",
-			},
-		},
-	}
+	opts := parseFlags()
 
-	if err := cfg.Validate(); err != nil {
-		log.Fatalf("[main] invalid config: %v", err)
+	cfg, err := config.LoadConfig(opts.configPath)
+	if err != nil {
+		log.Fatalf("[main] failed to load config: %v", err)
 	}
 
-	log.Println("[main] configuration validated successfully")
+	log.Printf("[main] configuration loaded from %s", opts.configPath)
 
-	resolver := &config.ConfigExitResolver{
-		Config: cfg,
-	}
+	resolver := config.NewConfigExitResolver(cfg)
 
-	log.Printf("[main] initialising Gluetun provider")
-	prov, err := provider.NewGluetunProvider(
-		provider.WithImageVersion("qmcgaw/gluetun:v3.41.0"),
-	)
-	if err != nil {
-		log.Fatalf("[main] failed to create Gluetun provider: %v", err)
+	prov := provider.NewRegistry()
+	prov.Register(config.ProviderDirect, provider.NewDirectProvider())
+	prov.Register(config.ProviderHTTP, provider.NewUpstreamProxyProvider())
+	prov.Register(config.ProviderSOCKS5, provider.NewSOCKS5Provider())
+
+	if err := registerGluetun(prov, cfg, opts); err != nil {
+		log.Fatalf("[main] %v", err)
 	}
 
 	// Ensure cleanup happens on exit
@@ -59,33 +49,122 @@ func main() {
 		}
 	}()
 
-	handler := handler.NewProxyHandler(
-		resolver,
-		prov,
-		handler.HeaderExitParser("X-GeoSwitch-Exit"),
+	// Start eager exits in the background; the admin API reports ready once they are up
+	warmCtx, stopWarmup := context.WithCancel(context.Background())
+	defer stopWarmup()
+	warmup := provider.StartWarmup(warmCtx, prov, cfg)
+
+	// Earlier parsers take precedence in choosing the exit and target
+	parsers := []handler.IntentParser{
+		handler.HeaderExitParser(opts.exitHeader),
+		handler.ProxyUserParser(resolver),
+		handler.ProxyAuthExitParser,
+		handler.QueryExitParser(opts.exitParam),
+		handler.CookieExitParser(opts.exitParam),
+	}
+	if opts.hostDomain != "" {
+		parsers = append(parsers, handler.HostIntentParser(opts.hostDomain))
+	}
+	parsers = append(parsers,
+		handler.ConnectParser,
+		handler.AbsoluteFormParser,
+		handler.QueryTargetParser(opts.targetParam),
 		handler.PathIntentParser,
 	)
 
+	handler := handler.NewProxyHandler(resolver, prov, parsers...)
+
 	// Create HTTP server
 	server := &http.Server{
-		Addr:    ":8080",
+		Addr:    opts.listenAddr,
 		Handler: handler,
 	}
 
-	// Set up signal handling for graceful shutdown
+	// Admin API runs on its own listener so it can be kept off the proxy port
+	var adminServer *http.Server
+	if opts.adminListenAddr != "" {
+		adminServer = &http.Server{
+			Addr:    opts.adminListenAddr,
+			Handler: admin.NewHandler(resolver, prov, admin.WithWarmup(warmup)),
+		}
+	}
+
+	// Reload the config when the file changes, stopping exits that were removed or
+	// changed, updating those whose changes need no restart, and warming up those
+	// that are added or changed and eager in the new config
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+
+	watcher := config.NewWatcher(
+		opts.configPath,
+		resolver,
+		config.WithPollInterval(opts.reloadInterval),
+		// A reload may add the first gluetun exit
+		config.BeforeReload(func(new *config.Config) error {
+			return registerGluetun(prov, new, opts)
+		}),
+		config.OnReload(func(old, new *config.Config) {
+			for _, exitName := range config.ChangedExits(old, new) {
+				go func() {
+					ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+					defer cancel()
+					if err := prov.StopExit(ctx, exitName); err != nil {
+						log.Printf("[main] error stopping exit '%s': %v", exitName, err)
+					}
+
+					if exit, ok := new.GetExit(exitName); ok && exit.Eager {
+						warmup.Warm(exitName, exit)
+					} else {
+						warmup.Forget(exitName)
+					}
+				}()
+			}
+
+			// Settings like fallback or idle_timeout apply to running exits without a restart
+			for _, exitName := range config.ReconfiguredExits(old, new) {
+				exit, _ := new.GetExit(exitName)
+				prov.UpdateExit(exitName, exit)
+
+				wasEager := old.Exits[exitName].Eager
+				switch {
+				case exit.Eager && !wasEager:
+					warmup.Warm(exitName, exit)
+				case !exit.Eager && wasEager:
+					warmup.Forget(exitName)
+				}
+			}
+		}),
+	)
+	go watcher.Run(watchCtx)
+
+	// Set up signal handling for graceful shutdown and reloads
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 
 	// Start server in a goroutine
 	go func() {
-		log.Println("[main] starting GeoSwitch on :8080")
+		log.Printf("[main] starting GeoSwitch on %s", opts.listenAddr)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("[main] server error: %v", err)
 		}
 	}()
 
-	// Wait for interrupt signal
+	if adminServer != nil {
+		go func() {
+			log.Printf("[main] starting admin API on %s", opts.adminListenAddr)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("[main] admin server error: %v", err)
+			}
+		}()
+	}
+
+	// Wait for interrupt signal, reloading the config on SIGHUP
 	sig := <-sigChan
+	for sig == syscall.SIGHUP {
+		log.Printf("[main] received SIGHUP, reloading configuration")
+		watcher.Reload()
+		sig = <-sigChan
+	}
 	log.Printf("[main] received signal: %v, initiating graceful shutdown", sig)
 
 	// Attempt graceful shutdown
@@ -96,5 +175,43 @@ func main() {
 		log.Printf("[main] error during server shutdown: %v", err)
 	}
 
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			log.Printf("[main] error during admin server shutdown: %v", err)
+		}
+	}
+
 	log.Println("[main] shutdown complete")
 }
+
+// registerGluetun creates the Gluetun provider and registers it once cfg has a
+// gluetun exit. Gluetun needs access to the Docker daemon, so it is not started
+// before an exit uses it.
+func registerGluetun(prov *provider.Registry, cfg *config.Config, opts options) error {
+	if !cfg.UsesProvider(config.ProviderGluetun) {
+		return nil
+	}
+	if _, ok := prov.Lookup(config.ProviderGluetun); ok {
+		return nil
+	}
+
+	log.Printf("[main] initialising Gluetun provider")
+	gluetun, err := provider.NewGluetunProvider(
+		provider.WithImageVersion(opts.gluetunImage),
+		provider.WithOwnerID(opts.ownerID),
+		provider.WithIPEchoURL(opts.ipEchoURL),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create Gluetun provider: %w", err)
+	}
+
+	// Adopt or clean up containers left behind by a previous run
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := gluetun.Reconcile(ctx, cfg); err != nil {
+		log.Printf("[main] failed to reconcile Gluetun containers: %v", err)
+	}
+
+	prov.Register(config.ProviderGluetun, gluetun)
+	return nil
+}
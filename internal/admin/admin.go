@@ -0,0 +1,274 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"geoswitch/internal/config"
+	"geoswitch/internal/provider"
+)
+
+// exitResponse is the JSON representation of an exit on the admin API.
+// It only exposes non-sensitive configuration alongside runtime state.
+type exitResponse struct {
+	Name     string `json:"name"`
+	Provider string `json:"provider"`
+	Country  string `json:"country"`
+	Default  bool   `json:"default"`
+
+	State         string    `json:"state"`
+	ContainerID   string    `json:"container_id,omitempty"`
+	ContainerName string    `json:"container_name,omitempty"`
+	Health        string    `json:"health,omitempty"`
+	CreatedAt     time.Time `json:"created_at,omitzero"`
+	LastUsedAt    time.Time `json:"last_used_at,omitzero"`
+	EgressIP      string    `json:"egress_ip,omitempty"`
+	EgressCountry string    `json:"egress_country,omitempty"`
+
+	// Members holds the runtime state of each member of a pool exit.
+	Members map[string]memberResponse `json:"members,omitempty"`
+}
+
+// memberResponse is the runtime state of a single member of a pool exit.
+type memberResponse struct {
+	State         string    `json:"state"`
+	ContainerID   string    `json:"container_id,omitempty"`
+	ContainerName string    `json:"container_name,omitempty"`
+	Health        string    `json:"health,omitempty"`
+	CreatedAt     time.Time `json:"created_at,omitzero"`
+	LastUsedAt    time.Time `json:"last_used_at,omitzero"`
+	EgressIP      string    `json:"egress_ip,omitempty"`
+	EgressCountry string    `json:"egress_country,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// readyResponse reports whether all eager exits have started.
+type readyResponse struct {
+	Status string                    `json:"status"` // "ready" or "starting"
+	Exits  map[string]warmupResponse `json:"exits"`
+}
+
+type warmupResponse struct {
+	State    string `json:"state"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Provider is the view of the exit provider the admin API works with,
+// satisfied by *provider.Registry.
+type Provider interface {
+	provider.StatusReporter
+	provider.ExitController
+}
+
+// Option is a functional option for configuring the admin API.
+type Option func(*api)
+
+// WithWarmup makes /readyz report the progress of warming up eager exits.
+// Without it the server is always reported ready.
+func WithWarmup(w *provider.Warmup) Option {
+	return func(a *api) {
+		a.warmup = w
+	}
+}
+
+// NewHandler returns the admin API handler. It serves:
+//
+//	GET  /healthz              liveness of the GeoSwitch process
+//	GET  /readyz               readiness, once all eager exits have started
+//	GET  /exits                all configured exits with their runtime status
+//	GET  /exits/{name}         a single exit
+//	POST /exits/{name}/start   start the exit and wait until it is ready
+//	POST /exits/{name}/stop    drain and stop the exit
+//	POST /exits/{name}/restart stop and start the exit
+func NewHandler(resolver *config.ConfigExitResolver, prov Provider, opts ...Option) http.Handler {
+	a := &api{
+		resolver: resolver,
+		provider: prov,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", a.healthz)
+	mux.HandleFunc("GET /readyz", a.readyz)
+	mux.HandleFunc("GET /exits", a.listExits)
+	mux.HandleFunc("GET /exits/{name}", a.getExit)
+	mux.HandleFunc("POST /exits/{name}/start", a.controlExit("start"))
+	mux.HandleFunc("POST /exits/{name}/stop", a.controlExit("stop"))
+	mux.HandleFunc("POST /exits/{name}/restart", a.controlExit("restart"))
+	return mux
+}
+
+type api struct {
+	resolver *config.ConfigExitResolver
+	provider Provider
+	warmup   *provider.Warmup
+}
+
+func (a *api) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (a *api) readyz(w http.ResponseWriter, r *http.Request) {
+	resp := readyResponse{
+		Status: "ready",
+		Exits:  make(map[string]warmupResponse),
+	}
+
+	if a.warmup == nil {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	ready := true
+	for name, status := range a.warmup.Status() {
+		exit := warmupResponse{State: status.State, Attempts: status.Attempts}
+		if status.Err != nil {
+			exit.Error = status.Err.Error()
+		}
+		resp.Exits[name] = exit
+		ready = ready && status.State == provider.StateRunning
+	}
+
+	if !ready {
+		resp.Status = "starting"
+		writeJSON(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *api) listExits(w http.ResponseWriter, r *http.Request) {
+	cfg := a.resolver.Config()
+
+	names := make([]string, 0, len(cfg.Exits))
+	for name := range cfg.Exits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	exits := make([]exitResponse, 0, len(names))
+	for _, name := range names {
+		exits = append(exits, a.describe(r, cfg, name))
+	}
+
+	writeJSON(w, http.StatusOK, exits)
+}
+
+func (a *api) getExit(w http.ResponseWriter, r *http.Request) {
+	cfg := a.resolver.Config()
+	name := r.PathValue("name")
+
+	if _, ok := cfg.GetExit(name); !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "unknown exit '" + name + "'"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.describe(r, cfg, name))
+}
+
+// stopTimeout bounds how long a stop request waits for the exit to drain
+// before its container is stopped anyway.
+const stopTimeout = 30 * time.Second
+
+// controlExit returns a handler applying action to the exit named in the path
+// and responding with the exit's resulting status.
+func (a *api) controlExit(action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := a.resolver.Config()
+		name := r.PathValue("name")
+
+		exit, ok := cfg.GetExit(name)
+		if !ok {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "unknown exit '" + name + "'"})
+			return
+		}
+
+		log.Printf("[admin] %s requested for exit '%s'", action, name)
+
+		var err error
+		switch action {
+		case "start":
+			err = a.provider.StartExit(r.Context(), name, exit)
+		case "stop":
+			// The client may wait forever, but open CONNECT tunnels must not hold the stop up
+			ctx, cancel := context.WithTimeout(r.Context(), stopTimeout)
+			err = a.provider.StopExit(ctx, name)
+			cancel()
+		case "restart":
+			// Draining the old runtime is bounded by the provider, and the
+			// start waits for the exit's startup_timeout
+			err = a.provider.RestartExit(r.Context(), name, exit)
+		}
+
+		if err != nil {
+			log.Printf("[admin] %s failed for exit '%s': %v", action, name, err)
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: action + " failed: " + err.Error()})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, a.describe(r, cfg, name))
+	}
+}
+
+// describe builds the response for a configured exit.
+func (a *api) describe(r *http.Request, cfg *config.Config, name string) exitResponse {
+	exit, _ := cfg.GetExit(name)
+
+	resp := exitResponse{
+		Name:     name,
+		Provider: exit.Provider,
+		Country:  exit.Country,
+		Default:  name == cfg.DefaultExit,
+		State:    "unknown",
+	}
+
+	status, ok := a.provider.ExitStatus(r.Context(), name, exit)
+	if !ok {
+		return resp
+	}
+
+	resp.State = status.State
+	resp.ContainerID = status.ContainerID
+	resp.ContainerName = status.ContainerName
+	resp.Health = status.Health
+	resp.CreatedAt = status.CreatedAt
+	resp.LastUsedAt = status.LastUsedAt
+	resp.EgressIP = status.EgressIP
+	resp.EgressCountry = status.EgressCountry
+
+	if len(status.Members) > 0 {
+		resp.Members = make(map[string]memberResponse, len(status.Members))
+		for member, ms := range status.Members {
+			resp.Members[member] = memberResponse{
+				State:         ms.State,
+				ContainerID:   ms.ContainerID,
+				ContainerName: ms.ContainerName,
+				Health:        ms.Health,
+				CreatedAt:     ms.CreatedAt,
+				LastUsedAt:    ms.LastUsedAt,
+				EgressIP:      ms.EgressIP,
+				EgressCountry: ms.EgressCountry,
+			}
+		}
+	}
+	return resp
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[admin] failed to write response: %v", err)
+	}
+}
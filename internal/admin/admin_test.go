@@ -0,0 +1,260 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"geoswitch/internal/config"
+	"geoswitch/internal/provider"
+)
+
+type fakeProvider struct {
+	statuses map[string]provider.ExitStatus
+	calls    []string
+	err      error
+
+	stopDeadline bool // whether StopExit was called with a deadline
+}
+
+func (f *fakeProvider) ExitStatus(_ context.Context, exitName string, _ config.ExitConfig) (provider.ExitStatus, bool) {
+	status, ok := f.statuses[exitName]
+	return status, ok
+}
+
+func (f *fakeProvider) StartExit(_ context.Context, exitName string, _ config.ExitConfig) error {
+	f.calls = append(f.calls, "start "+exitName)
+	return f.err
+}
+
+func (f *fakeProvider) StopExit(ctx context.Context, exitName string) error {
+	f.calls = append(f.calls, "stop "+exitName)
+	_, f.stopDeadline = ctx.Deadline()
+	return f.err
+}
+
+func (f *fakeProvider) RestartExit(_ context.Context, exitName string, _ config.ExitConfig) error {
+	f.calls = append(f.calls, "restart "+exitName)
+	return f.err
+}
+
+func newTestResolver() *config.ConfigExitResolver {
+	return config.NewConfigExitResolver(&config.Config{
+		DefaultExit: "kr",
+		Exits: map[string]config.ExitConfig{
+			"kr": {Provider: "gluetun", Country: "Korea"},
+			"uk": {Provider: "gluetun", Country: "United Kingdom"},
+		},
+	})
+}
+
+func TestHealthz(t *testing.T) {
+	h := NewHandler(newTestResolver(), &fakeProvider{})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestListExits(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	prov := &fakeProvider{statuses: map[string]provider.ExitStatus{
+		"kr": {
+			State:         provider.StateRunning,
+			ContainerID:   "abc123",
+			ContainerName: "gluetun-kr",
+			Health:        "healthy",
+			CreatedAt:     created,
+			EgressIP:      "203.0.113.7",
+			EgressCountry: "South Korea",
+		},
+	}}
+
+	h := NewHandler(newTestResolver(), prov)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/exits", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var exits []exitResponse
+	if err := json.NewDecoder(w.Body).Decode(&exits); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if len(exits) != 2 || exits[0].Name != "kr" || exits[1].Name != "uk" {
+		t.Fatalf("expected exits [kr uk], got %+v", exits)
+	}
+
+	kr := exits[0]
+	if !kr.Default || kr.State != "running" || kr.ContainerID != "abc123" || kr.Health != "healthy" {
+		t.Errorf("unexpected kr status: %+v", kr)
+	}
+	if kr.EgressIP != "203.0.113.7" || kr.EgressCountry != "South Korea" {
+		t.Errorf("unexpected kr egress: %+v", kr)
+	}
+	if !kr.CreatedAt.Equal(created) {
+		t.Errorf("expected created_at %v, got %v", created, kr.CreatedAt)
+	}
+
+	if exits[1].State != "unknown" {
+		t.Errorf("expected uk state 'unknown', got '%s'", exits[1].State)
+	}
+}
+
+func TestGetExit_Unknown(t *testing.T) {
+	h := NewHandler(newTestResolver(), &fakeProvider{})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/exits/missing", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestGetExit_Known(t *testing.T) {
+	h := NewHandler(newTestResolver(), &fakeProvider{})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/exits/uk", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var exit exitResponse
+	if err := json.NewDecoder(w.Body).Decode(&exit); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if exit.Name != "uk" || exit.Country != "United Kingdom" || exit.Default {
+		t.Errorf("unexpected exit: %+v", exit)
+	}
+}
+
+func TestControlExit(t *testing.T) {
+	for _, action := range []string{"start", "stop", "restart"} {
+		t.Run(action, func(t *testing.T) {
+			prov := &fakeProvider{}
+			h := NewHandler(newTestResolver(), prov)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/exits/kr/"+action, nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+			}
+
+			if len(prov.calls) != 1 || prov.calls[0] != action+" kr" {
+				t.Errorf("expected call '%s kr', got %v", action, prov.calls)
+			}
+		})
+	}
+}
+
+func TestControlExit_StopHasDeadline(t *testing.T) {
+	prov := &fakeProvider{}
+	h := NewHandler(newTestResolver(), prov)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/exits/kr/stop", nil))
+
+	if !prov.stopDeadline {
+		t.Error("expected stop to be bounded by a deadline")
+	}
+}
+
+func TestControlExit_UnknownExit(t *testing.T) {
+	prov := &fakeProvider{}
+	h := NewHandler(newTestResolver(), prov)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/exits/missing/restart", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	if len(prov.calls) != 0 {
+		t.Errorf("expected no provider calls, got %v", prov.calls)
+	}
+}
+
+func TestControlExit_ProviderError(t *testing.T) {
+	prov := &fakeProvider{err: errors.New("container failed health check")}
+	h := NewHandler(newTestResolver(), prov)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/exits/kr/start", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestControlExit_RequiresPost(t *testing.T) {
+	h := NewHandler(newTestResolver(), &fakeProvider{})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/exits/kr/stop", nil))
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestReadyz_WithoutWarmup(t *testing.T) {
+	h := NewHandler(newTestResolver(), &fakeProvider{})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+// blockingController never finishes starting exits until its context is cancelled.
+type blockingController struct{ fakeProvider }
+
+func (b *blockingController) StartExit(ctx context.Context, _ string, _ config.ExitConfig) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestReadyz_EagerExitStarting(t *testing.T) {
+	cfg := &config.Config{
+		DefaultExit: "kr",
+		Exits: map[string]config.ExitConfig{
+			"kr": {Provider: "gluetun", Country: "Korea", Eager: true},
+		},
+	}
+	warmup := provider.StartWarmup(t.Context(), &blockingController{}, cfg)
+
+	h := NewHandler(config.NewConfigExitResolver(cfg), &fakeProvider{}, WithWarmup(warmup))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	var resp readyResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Status != "starting" || resp.Exits["kr"].State != provider.StateStarting {
+		t.Errorf("unexpected readiness: %+v", resp)
+	}
+}
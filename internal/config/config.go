@@ -1,28 +1,256 @@
 package config
 
 import (
+	"cmp"
 	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"os"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"geoswitch/internal/types"
 
 	"go.yaml.in/yaml/v4"
 )
 
+// Built-in provider names accepted in ExitConfig.Provider.
+const (
+	ProviderGluetun = "gluetun"
+	ProviderDirect  = "direct"
+	ProviderHTTP    = "http"
+	ProviderSOCKS5  = "socks5"
+)
+
+// knownProviders is the set of provider names Validate accepts.
+var knownProviders = map[string]bool{
+	ProviderGluetun: true,
+	ProviderDirect:  true,
+	ProviderHTTP:    true,
+	ProviderSOCKS5:  true,
+}
+
 // ExitConfig defines the configuration for a network exit point.
 type ExitConfig struct {
 	Provider string `yaml:"provider"`
 	Country  string `yaml:"country"`
+
+	// SourceIP binds outgoing connections of a direct exit to a local address.
+	SourceIP string `yaml:"source_ip,omitempty"`
+	// Interface binds outgoing connections of a direct exit to a network interface.
+	Interface string `yaml:"interface,omitempty"`
+
+	// URL is the upstream proxy of an http exit, e.g. "http://proxy.example.com:3128".
+	URL string `yaml:"url,omitempty"`
+	// Address is the host:port of the SOCKS5 server of a socks5 exit.
+	Address string `yaml:"address,omitempty"`
+	// RemoteDNS lets the SOCKS5 server resolve target hostnames.
+	RemoteDNS bool `yaml:"remote_dns,omitempty"`
+	// Username and Password authenticate against the upstream proxy.
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	// PasswordFile is read for the password when Password is empty, like a
+	// ${file:...} reference, when the config is loaded.
+	PasswordFile string `yaml:"password_file,omitempty"`
+
+	// Gluetun holds the VPN settings of a gluetun exit.
+	Gluetun *GluetunSettings `yaml:"gluetun,omitempty"`
+
+	// Replicas runs a gluetun exit as a pool of this many identical containers.
+	Replicas int `yaml:"replicas,omitempty"`
+	// Members runs a gluetun exit as a pool with one container per entry, each
+	// with its own VPN settings. It replaces the gluetun block.
+	Members []GluetunSettings `yaml:"members,omitempty"`
+	// Balance selects how requests are spread over a pool: "round_robin" (the
+	// default) or "least_conn".
+	Balance string `yaml:"balance,omitempty"`
+	// MinReady is how many members of a pool must be healthy for the exit to
+	// count as started, and an eager pool as ready. Defaults to all members.
+	MinReady int `yaml:"min_ready,omitempty"`
+
+	// StartupTimeout bounds how long a gluetun exit may take to become healthy, default 60s.
+	StartupTimeout time.Duration `yaml:"startup_timeout,omitempty"`
+	// HealthPollInterval is how often a starting gluetun exit is checked, default 1s.
+	HealthPollInterval time.Duration `yaml:"health_poll_interval,omitempty"`
+	// ProbeURL, if set, is requested through a starting gluetun exit, which is
+	// only declared healthy once the request succeeds.
+	ProbeURL string `yaml:"probe_url,omitempty"`
+	// MissingHealthcheck decides what happens when the container has no Docker
+	// healthcheck: "fail" (the default) or "assume_healthy" once it is running.
+	MissingHealthcheck string `yaml:"missing_healthcheck,omitempty"`
+	// VerifyCountry refuses to serve a gluetun exit whose egress, as reported by
+	// the IP echo service, is not in Country.
+	VerifyCountry bool `yaml:"verify_country,omitempty"`
+
+	// IdleTimeout stops the exit's container after it has served no requests
+	// for this long, e.g. "15m". Zero inherits Config.IdleTimeout; if that is
+	// zero too the exit runs until shutdown.
+	IdleTimeout time.Duration `yaml:"idle_timeout,omitempty"`
+	// Fallback lists exits to try in order when this exit cannot be served,
+	// e.g. [uk, de]. Fallbacks of fallbacks are not followed.
+	Fallback []string `yaml:"fallback,omitempty"`
+
+	// Eager starts the exit when GeoSwitch starts instead of on its first
+	// request. Eager exits are never stopped for being idle, and are started
+	// again when their container stops unexpectedly.
+	Eager bool `yaml:"eager,omitempty"`
+
+	// Pool is the name of the pool exit this is a member of. It is set by
+	// PoolMembers and never read from the config file.
+	Pool string `yaml:"-"`
+}
+
+// Balancing strategies for pool exits.
+const (
+	BalanceRoundRobin = "round_robin"
+	BalanceLeastConn  = "least_conn"
+)
+
+// PoolMember is a single container of a pool exit.
+type PoolMember struct {
+	Name string     // "<exit>-<i>", counting from 1
+	Exit ExitConfig // the exit's settings with Gluetun set to the member's own
+}
+
+// IsPool reports whether the exit runs as a pool of several containers.
+func (e ExitConfig) IsPool() bool {
+	return e.Replicas > 1 || len(e.Members) > 0
+}
+
+// PoolMembers expands a pool exit named name into its members, or returns nil
+// if the exit is not a pool.
+func (e ExitConfig) PoolMembers(name string) []PoolMember {
+	if !e.IsPool() {
+		return nil
+	}
+
+	settings := e.Members
+	if len(settings) == 0 {
+		settings = make([]GluetunSettings, e.Replicas)
+		for i := range settings {
+			settings[i] = *e.Gluetun
+		}
+	}
+
+	members := make([]PoolMember, len(settings))
+	for i := range settings {
+		member := e
+		member.Replicas = 0
+		member.Members = nil
+		member.MinReady = 0
+		member.Gluetun = &settings[i]
+		member.Pool = name
+		members[i] = PoolMember{Name: fmt.Sprintf("%s-%d", name, i+1), Exit: member}
+	}
+	return members
+}
+
+// Policies for gluetun exits whose container has no Docker healthcheck.
+const (
+	MissingHealthcheckFail          = "fail"
+	MissingHealthcheckAssumeHealthy = "assume_healthy"
+)
+
+// VPN types supported by Gluetun.
+const (
+	VPNTypeOpenVPN   = "openvpn"
+	VPNTypeWireguard = "wireguard"
+)
+
+// GluetunSettings configures the Gluetun container of a single exit.
+// Each field maps to a Gluetun environment variable, so exits can use
+// different VPN accounts, protocols and servers.
+type GluetunSettings struct {
+	ServiceProvider string `yaml:"vpn_service_provider"`       // VPN_SERVICE_PROVIDER
+	VPNType         string `yaml:"vpn_type,omitempty"`         // VPN_TYPE, defaults to openvpn
+	OpenVPNUser     string `yaml:"openvpn_user,omitempty"`     // OPENVPN_USER
+	OpenVPNPassword string `yaml:"openvpn_password,omitempty"` // OPENVPN_PASSWORD
+
+	WireguardPrivateKey string `yaml:"wireguard_private_key,omitempty"` // WIREGUARD_PRIVATE_KEY
+	WireguardAddresses  string `yaml:"wireguard_addresses,omitempty"`   // WIREGUARD_ADDRESSES
+
+	ServerCities    []string `yaml:"server_cities,omitempty"`    // SERVER_CITIES
+	ServerHostnames []string `yaml:"server_hostnames,omitempty"` // SERVER_HOSTNAMES
+
+	// Env holds additional environment variables passed to the container as-is.
+	Env map[string]string `yaml:"env,omitempty"`
+}
+
+// Validate checks that the settings contain the keys required by their VPN type.
+func (g *GluetunSettings) Validate() error {
+	if g.ServiceProvider == "" {
+		return fmt.Errorf("gluetun.vpn_service_provider is required")
+	}
+
+	switch g.VPNType {
+	case "", VPNTypeOpenVPN:
+		if g.OpenVPNUser == "" {
+			return fmt.Errorf("gluetun.openvpn_user is required for openvpn")
+		}
+	case VPNTypeWireguard:
+		if g.WireguardPrivateKey == "" {
+			return fmt.Errorf("gluetun.wireguard_private_key is required for wireguard")
+		}
+	default:
+		return fmt.Errorf("gluetun.vpn_type must be '%s' or '%s'", VPNTypeOpenVPN, VPNTypeWireguard)
+	}
+
+	for key := range g.Env {
+		if key == "" || strings.ContainsAny(key, "= ") {
+			return fmt.Errorf("gluetun.env has invalid variable name '%s'", key)
+		}
+	}
+
+	return nil
 }
 
 type Config struct {
 	DefaultExit string                `yaml:"default_exit"`
 	Exits       map[string]ExitConfig `yaml:"exits"`
+
+	// IdleTimeout is the idle_timeout of exits that do not set their own.
+	IdleTimeout time.Duration `yaml:"idle_timeout,omitempty"`
+
+	// FallbackPolicy decides where requests go when their exit is unavailable:
+	// "chain" (the default) tries the exit's fallback list, "default" tries the
+	// default exit after it, and "none" disables failover.
+	FallbackPolicy string `yaml:"fallback_policy,omitempty"`
+
+	// ProxyAuth configures the credentials of clients using GeoSwitch as a proxy.
+	ProxyAuth ProxyAuthConfig `yaml:"proxy_auth,omitempty"`
 }
 
+// ProxyAuthConfig configures Proxy-Authorization credentials, whose username
+// can select the exit and session of a request, e.g. "alice-exit-kr-session-42".
+type ProxyAuthConfig struct {
+	// Pattern is the layout of usernames selecting an exit, with <user> and
+	// <exit> placeholders. Defaults to DefaultProxyAuthPattern. Flags such as
+	// "-session-<id>" may follow it.
+	Pattern string `yaml:"pattern,omitempty"`
+
+	// Users maps the usernames clients authenticate as to their passwords.
+	Users map[string]string `yaml:"users,omitempty"`
+
+	// Required rejects requests without credentials. Otherwise only
+	// credentials that are present are checked.
+	Required bool `yaml:"required,omitempty"`
+}
+
+// DefaultProxyAuthPattern is the username pattern used when none is configured.
+const DefaultProxyAuthPattern = "<user>-exit-<exit>"
+
+// Fallback policies.
+const (
+	FallbackChain   = "chain"
+	FallbackDefault = "default"
+	FallbackNone    = "none"
+)
+
 // LoadConfig reads and parses a YAML configuration file.
+// Any string value may be written as a secret reference, which is resolved
+// before validation: ${env:NAME}, ${file:/path} or ${secret:name} (read from /run/secrets).
 func LoadConfig(path string) (*Config, error) {
 	log.Printf("[config] loading configuration from %s", path)
 	data, err := os.ReadFile(path)
@@ -43,7 +271,21 @@ func LoadConfig(path string) (*Config, error) {
 		config.Exits[name] = exit
 	}
 
+	// Substitute ${env:...}, ${file:...} and ${secret:...} references
+	secrets, err := resolveSecrets(&config)
+	if err == nil {
+		err = secrets.resolvePasswordFiles(&config)
+	}
+	if err != nil {
+		log.Printf("[config] failed to resolve secrets: %v", err)
+		return nil, fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+
+	config.applyDefaults()
+
 	if err := config.Validate(); err != nil {
+		// Validation errors may quote field values, which must not leak secrets
+		err = secrets.redact(err)
 		log.Printf("[config] validation failed: %v", err)
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
@@ -52,6 +294,16 @@ func LoadConfig(path string) (*Config, error) {
 	return &config, nil
 }
 
+// applyDefaults copies global settings into the exits that do not override them.
+func (c *Config) applyDefaults() {
+	for name, exit := range c.Exits {
+		if exit.IdleTimeout == 0 {
+			exit.IdleTimeout = c.IdleTimeout
+		}
+		c.Exits[name] = exit
+	}
+}
+
 // Validate checks if the configuration is valid.
 func (c *Config) Validate() error {
 	if c.DefaultExit == "" {
@@ -66,32 +318,219 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("default_exit '%s' is not defined in exits", c.DefaultExit)
 	}
 
+	if c.IdleTimeout < 0 {
+		return fmt.Errorf("idle_timeout must not be negative")
+	}
+
+	switch c.FallbackPolicy {
+	case "", FallbackChain, FallbackDefault, FallbackNone:
+	default:
+		return fmt.Errorf("fallback_policy must be '%s', '%s' or '%s'", FallbackChain, FallbackDefault, FallbackNone)
+	}
+
+	if err := c.ProxyAuth.validate(); err != nil {
+		return err
+	}
+
 	for name, exit := range c.Exits {
 		if exit.Provider == "" {
 			return fmt.Errorf("exit '%s': provider is required", name)
 		}
+		if !knownProviders[exit.Provider] {
+			return fmt.Errorf("exit '%s': unknown provider '%s'", name, exit.Provider)
+		}
 		if exit.Country == "" {
 			return fmt.Errorf("exit '%s': country is required", name)
 		}
+		if exit.Provider == ProviderHTTP {
+			if err := validateProxyURL(exit.URL); err != nil {
+				return fmt.Errorf("exit '%s': %w", name, err)
+			}
+		}
+		if exit.Provider == ProviderGluetun {
+			if err := c.validateGluetunExit(name, exit); err != nil {
+				return err
+			}
+		} else if exit.Replicas != 0 || len(exit.Members) > 0 || exit.MinReady != 0 {
+			return fmt.Errorf("exit '%s': replicas, members and min_ready are only supported for gluetun exits", name)
+		}
+		if exit.Provider == ProviderSOCKS5 {
+			if exit.Address == "" {
+				return fmt.Errorf("exit '%s': address is required", name)
+			}
+			if _, _, err := net.SplitHostPort(exit.Address); err != nil {
+				return fmt.Errorf("exit '%s': address must be host:port", name)
+			}
+		}
+		if exit.SourceIP != "" && net.ParseIP(exit.SourceIP) == nil {
+			return fmt.Errorf("exit '%s': invalid source_ip '%s'", name, exit.SourceIP)
+		}
+		if exit.SourceIP != "" && exit.Interface != "" {
+			return fmt.Errorf("exit '%s': source_ip and interface are mutually exclusive", name)
+		}
+		if exit.IdleTimeout < 0 {
+			return fmt.Errorf("exit '%s': idle_timeout must not be negative", name)
+		}
+		for _, fallback := range exit.Fallback {
+			if fallback == name {
+				return fmt.Errorf("exit '%s': cannot fall back to itself", name)
+			}
+			if _, ok := c.Exits[fallback]; !ok {
+				return fmt.Errorf("exit '%s': fallback '%s' is not defined in exits", name, fallback)
+			}
+		}
+		if exit.StartupTimeout < 0 || exit.HealthPollInterval < 0 {
+			return fmt.Errorf("exit '%s': startup_timeout and health_poll_interval must not be negative", name)
+		}
+		if exit.ProbeURL != "" {
+			if u, err := url.Parse(exit.ProbeURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("exit '%s': probe_url must be an absolute http or https URL", name)
+			}
+		}
+		switch exit.MissingHealthcheck {
+		case "", MissingHealthcheckFail, MissingHealthcheckAssumeHealthy:
+		default:
+			return fmt.Errorf("exit '%s': missing_healthcheck must be '%s' or '%s'",
+				name, MissingHealthcheckFail, MissingHealthcheckAssumeHealthy)
+		}
 	}
 
 	return nil
 }
 
+// validate checks the username pattern and users of the proxy_auth section.
+func (a ProxyAuthConfig) validate() error {
+	if a.Required && len(a.Users) == 0 {
+		return fmt.Errorf("proxy_auth.required needs at least one user")
+	}
+
+	pattern := cmp.Or(a.Pattern, DefaultProxyAuthPattern)
+	if strings.Count(pattern, "<user>") != 1 || strings.Count(pattern, "<exit>") != 1 {
+		return fmt.Errorf("proxy_auth.pattern must contain <user> and <exit> exactly once")
+	}
+	if strings.Contains(pattern, ":") {
+		return fmt.Errorf("proxy_auth.pattern must not contain ':'")
+	}
+
+	for user := range a.Users {
+		if user == "" || strings.Contains(user, ":") {
+			return fmt.Errorf("proxy_auth.users has invalid username '%s'", user)
+		}
+	}
+	return nil
+}
+
+// validateGluetunExit checks the VPN and pool settings of a gluetun exit.
+func (c *Config) validateGluetunExit(name string, exit ExitConfig) error {
+	if exit.Replicas < 0 {
+		return fmt.Errorf("exit '%s': replicas must not be negative", name)
+	}
+
+	switch exit.Balance {
+	case "", BalanceRoundRobin, BalanceLeastConn:
+	default:
+		return fmt.Errorf("exit '%s': balance must be '%s' or '%s'", name, BalanceRoundRobin, BalanceLeastConn)
+	}
+
+	if len(exit.Members) > 0 {
+		if exit.Gluetun != nil || exit.Replicas != 0 {
+			return fmt.Errorf("exit '%s': members cannot be combined with gluetun or replicas", name)
+		}
+		for i := range exit.Members {
+			if err := exit.Members[i].Validate(); err != nil {
+				return fmt.Errorf("exit '%s': members[%d]: %w", name, i, err)
+			}
+		}
+	} else {
+		if exit.Gluetun == nil {
+			return fmt.Errorf("exit '%s': gluetun settings are required", name)
+		}
+		if err := exit.Gluetun.Validate(); err != nil {
+			return fmt.Errorf("exit '%s': %w", name, err)
+		}
+	}
+
+	members := exit.PoolMembers(name)
+	switch {
+	case exit.MinReady < 0:
+		return fmt.Errorf("exit '%s': min_ready must not be negative", name)
+	case exit.MinReady > 0 && !exit.IsPool():
+		return fmt.Errorf("exit '%s': min_ready requires replicas or members", name)
+	case exit.MinReady > len(members):
+		return fmt.Errorf("exit '%s': min_ready exceeds the %d pool members", name, len(members))
+	}
+
+	// Members get containers named after them, which must not clash with other exits
+	for _, member := range members {
+		if _, ok := c.Exits[member.Name]; ok {
+			return fmt.Errorf("exit '%s': pool member name '%s' clashes with another exit", name, member.Name)
+		}
+	}
+
+	return nil
+}
+
+// validateProxyURL checks that raw is an absolute http or https proxy URL.
+func validateProxyURL(raw string) error {
+	if raw == "" {
+		return fmt.Errorf("url is required")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid url")
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// UsesProvider reports whether any exit is configured with the named provider.
+func (c *Config) UsesProvider(name string) bool {
+	for _, exit := range c.Exits {
+		if exit.Provider == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigExitResolver resolves exit names against the active Config.
+// The Config can be replaced at runtime with Store; every call to Resolve
+// works on a single snapshot, so in-flight requests keep the view they started with.
 type ConfigExitResolver struct {
-	Config *Config
+	config atomic.Pointer[Config]
+}
+
+// NewConfigExitResolver returns a resolver backed by cfg.
+func NewConfigExitResolver(cfg *Config) *ConfigExitResolver {
+	r := &ConfigExitResolver{}
+	r.config.Store(cfg)
+	return r
+}
+
+// Config returns the currently active configuration snapshot.
+func (r *ConfigExitResolver) Config() *Config {
+	return r.config.Load()
+}
+
+// Store atomically replaces the active configuration and returns the previous one.
+func (r *ConfigExitResolver) Store(cfg *Config) *Config {
+	return r.config.Swap(cfg)
 }
 
 func (r *ConfigExitResolver) Resolve(exit *types.Exit) (string, ExitConfig, error) {
+	config := r.Config()
+
 	// No exit specified → default
 	if exit == nil || exit.Name == "" {
-		name := r.Config.DefaultExit
-		cfg, _ := r.Config.GetExit(name)
+		name := config.DefaultExit
+		cfg, _ := config.GetExit(name)
 		log.Printf("[resolver] using default exit: %s", name)
 		return name, cfg, nil
 	}
 
-	cfg, ok := r.Config.GetExit(exit.Name)
+	cfg, ok := config.GetExit(exit.Name)
 	if !ok {
 		return "", ExitConfig{}, fmt.Errorf("unknown exit '%s'", exit.Name)
 	}
@@ -99,16 +538,61 @@ func (r *ConfigExitResolver) Resolve(exit *types.Exit) (string, ExitConfig, erro
 	return exit.Name, cfg, nil
 }
 
+// ResolvedExit is a configured exit together with its name.
+type ResolvedExit struct {
+	Name   string
+	Config ExitConfig
+}
+
+// ResolveChain resolves exit like Resolve and returns it followed by the exits
+// to fall back to, in order, according to the exit's fallback list and the
+// fallback policy. All exits come from a single config snapshot.
+func (r *ConfigExitResolver) ResolveChain(exit *types.Exit) ([]ResolvedExit, error) {
+	config := r.Config()
+
+	name := config.DefaultExit
+	if exit != nil && exit.Name != "" {
+		name = exit.Name
+	}
+
+	primary, ok := config.GetExit(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown exit '%s'", name)
+	}
+
+	chain := []ResolvedExit{{Name: name, Config: primary}}
+	if config.FallbackPolicy == FallbackNone {
+		return chain, nil
+	}
+
+	seen := map[string]bool{name: true}
+	add := func(name string) {
+		if cfg, ok := config.GetExit(name); ok && !seen[name] {
+			seen[name] = true
+			chain = append(chain, ResolvedExit{Name: name, Config: cfg})
+		}
+	}
+
+	for _, fallback := range primary.Fallback {
+		add(fallback)
+	}
+	if config.FallbackPolicy == FallbackDefault {
+		add(config.DefaultExit)
+	}
+	return chain, nil
+}
+
 func (c *Config) GetExit(name string) (ExitConfig, bool) {
 	exit, ok := c.Exits[name]
 	return exit, ok
 }
 
 func (r *ConfigExitResolver) defaultExit() (ExitConfig, error) {
-	cfg, ok := r.Config.GetExit(r.Config.DefaultExit)
+	config := r.Config()
+	cfg, ok := config.GetExit(config.DefaultExit)
 	if !ok {
 		// This should never happen if config was validated
-		return ExitConfig{}, fmt.Errorf("default exit '%s' not defined", r.Config.DefaultExit)
+		return ExitConfig{}, fmt.Errorf("default exit '%s' not defined", config.DefaultExit)
 	}
 
 	return cfg, nil
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"fmt"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"geoswitch/internal/types"
 )
@@ -11,11 +14,11 @@ func TestConfig_Validate_ValidConfig(t *testing.T) {
 		DefaultExit: "us-exit",
 		Exits: map[string]ExitConfig{
 			"us-exit": {
-				Provider: "aws",
+				Provider: "direct",
 				Country:  "US",
 			},
 			"eu-exit": {
-				Provider: "gcp",
+				Provider: "direct",
 				Country:  "DE",
 			},
 		},
@@ -32,7 +35,7 @@ func TestConfig_Validate_MissingDefaultExit(t *testing.T) {
 		DefaultExit: "",
 		Exits: map[string]ExitConfig{
 			"us-exit": {
-				Provider: "aws",
+				Provider: "direct",
 				Country:  "US",
 			},
 		},
@@ -71,7 +74,7 @@ func TestConfig_Validate_DefaultExitNotDefined(t *testing.T) {
 		DefaultExit: "nonexistent",
 		Exits: map[string]ExitConfig{
 			"us-exit": {
-				Provider: "aws",
+				Provider: "direct",
 				Country:  "US",
 			},
 		},
@@ -115,7 +118,7 @@ func TestConfig_Validate_ExitMissingCountry(t *testing.T) {
 		DefaultExit: "us-exit",
 		Exits: map[string]ExitConfig{
 			"us-exit": {
-				Provider: "aws",
+				Provider: "direct",
 				Country:  "",
 			},
 		},
@@ -132,7 +135,7 @@ func TestConfig_Validate_ExitMissingCountry(t *testing.T) {
 	}
 }
 
-func TestConfig_Validate_MultipleExitsOneInvalid(t *testing.T) {
+func TestConfig_Validate_ExitUnknownProvider(t *testing.T) {
 	config := &Config{
 		DefaultExit: "us-exit",
 		Exits: map[string]ExitConfig{
@@ -140,6 +143,172 @@ func TestConfig_Validate_MultipleExitsOneInvalid(t *testing.T) {
 				Provider: "aws",
 				Country:  "US",
 			},
+		},
+	}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected error for unknown provider, got nil")
+	}
+
+	expected := "exit 'us-exit': unknown provider 'aws'"
+	if err.Error() != expected {
+		t.Errorf("expected error '%s', got '%s'", expected, err.Error())
+	}
+}
+
+func TestConfig_Validate_InvalidSourceIP(t *testing.T) {
+	config := &Config{
+		DefaultExit: "home",
+		Exits: map[string]ExitConfig{
+			"home": {
+				Provider: "direct",
+				Country:  "US",
+				SourceIP: "not-an-ip",
+			},
+		},
+	}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected error for invalid source_ip, got nil")
+	}
+
+	expected := "exit 'home': invalid source_ip 'not-an-ip'"
+	if err.Error() != expected {
+		t.Errorf("expected error '%s', got '%s'", expected, err.Error())
+	}
+}
+
+func TestConfig_Validate_HTTPExitMissingURL(t *testing.T) {
+	config := &Config{
+		DefaultExit: "proxy",
+		Exits: map[string]ExitConfig{
+			"proxy": {
+				Provider: "http",
+				Country:  "DE",
+			},
+		},
+	}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected error for missing url, got nil")
+	}
+
+	expected := "exit 'proxy': url is required"
+	if err.Error() != expected {
+		t.Errorf("expected error '%s', got '%s'", expected, err.Error())
+	}
+}
+
+func TestConfig_Validate_SOCKS5ExitInvalidAddress(t *testing.T) {
+	config := &Config{
+		DefaultExit: "tor",
+		Exits: map[string]ExitConfig{
+			"tor": {
+				Provider: "socks5",
+				Country:  "NL",
+				Address:  "tor",
+			},
+		},
+	}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected error for invalid address, got nil")
+	}
+
+	expected := "exit 'tor': address must be host:port"
+	if err.Error() != expected {
+		t.Errorf("expected error '%s', got '%s'", expected, err.Error())
+	}
+}
+
+func TestConfig_Validate_GluetunExitMissingSettings(t *testing.T) {
+	config := &Config{
+		DefaultExit: "kr",
+		Exits: map[string]ExitConfig{
+			"kr": {
+				Provider: "gluetun",
+				Country:  "Korea",
+			},
+		},
+	}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected error for missing gluetun settings, got nil")
+	}
+
+	expected := "exit 'kr': gluetun settings are required"
+	if err.Error() != expected {
+		t.Errorf("expected error '%s', got '%s'", expected, err.Error())
+	}
+}
+
+func TestConfig_Validate_GluetunRequiredKeys(t *testing.T) {
+	cases := []struct {
+		name     string
+		settings GluetunSettings
+		expected string
+	}{
+		{
+			"missingServiceProvider",
+			GluetunSettings{OpenVPNUser: "user"},
+			"exit 'kr': gluetun.vpn_service_provider is required",
+		},
+		{
+			"openvpnMissingUser",
+			GluetunSettings{ServiceProvider: "nordvpn"},
+			"exit 'kr': gluetun.openvpn_user is required for openvpn",
+		},
+		{
+			"wireguardMissingKey",
+			GluetunSettings{ServiceProvider: "mullvad", VPNType: "wireguard"},
+			"exit 'kr': gluetun.wireguard_private_key is required for wireguard",
+		},
+		{
+			"unknownVPNType",
+			GluetunSettings{ServiceProvider: "mullvad", VPNType: "ipsec"},
+			"exit 'kr': gluetun.vpn_type must be 'openvpn' or 'wireguard'",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := tc.settings
+			config := &Config{
+				DefaultExit: "kr",
+				Exits: map[string]ExitConfig{
+					"kr": {
+						Provider: "gluetun",
+						Country:  "Korea",
+						Gluetun:  &settings,
+					},
+				},
+			}
+
+			err := config.Validate()
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+
+			if err.Error() != tc.expected {
+				t.Errorf("expected error '%s', got '%s'", tc.expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_MultipleExitsOneInvalid(t *testing.T) {
+	config := &Config{
+		DefaultExit: "us-exit",
+		Exits: map[string]ExitConfig{
+			"us-exit": {
+				Provider: "direct",
+				Country:  "US",
+			},
 			"eu-exit": {
 				Provider: "",
 				Country:  "DE",
@@ -195,6 +364,22 @@ func TestLoadConfig_MultipleExits(t *testing.T) {
 	if len(config.Exits) < 2 {
 		t.Errorf("expected at least 2 exits, got %d", len(config.Exits))
 	}
+
+	exit, _ := config.GetExit("asia-pacific")
+	if exit.Gluetun == nil || exit.Gluetun.VPNType != "wireguard" {
+		t.Fatalf("expected wireguard gluetun settings, got %+v", exit.Gluetun)
+	}
+
+	if len(exit.Gluetun.ServerCities) != 1 || exit.Gluetun.ServerCities[0] != "Singapore" {
+		t.Errorf("expected server_cities [Singapore], got %v", exit.Gluetun.ServerCities)
+	}
+}
+
+func TestLoadConfig_UnknownProvider(t *testing.T) {
+	_, err := LoadConfig("testdata/config/unknown-provider.yaml")
+	if err == nil {
+		t.Fatal("expected error for unknown provider, got nil")
+	}
 }
 
 func TestLoadConfig_UnknownExitInDefault(t *testing.T) {
@@ -209,7 +394,7 @@ func TestConfig_GetExit_Success(t *testing.T) {
 		DefaultExit: "us",
 		Exits: map[string]ExitConfig{
 			"us": {
-				Provider: "aws",
+				Provider: "direct",
 				Country:  "US",
 			},
 		},
@@ -220,8 +405,8 @@ func TestConfig_GetExit_Success(t *testing.T) {
 		t.Fatal("expected exit to be found")
 	}
 
-	if exit.Provider != "aws" {
-		t.Errorf("expected provider 'aws', got '%s'", exit.Provider)
+	if exit.Provider != "direct" {
+		t.Errorf("expected provider 'direct', got '%s'", exit.Provider)
 	}
 
 	if exit.Country != "US" {
@@ -234,7 +419,7 @@ func TestConfig_GetExit_NotFound(t *testing.T) {
 		DefaultExit: "us",
 		Exits: map[string]ExitConfig{
 			"us": {
-				Provider: "aws",
+				Provider: "direct",
 				Country:  "US",
 			},
 		},
@@ -251,13 +436,13 @@ func TestConfigExitResolver_Resolve_Default(t *testing.T) {
 		DefaultExit: "us",
 		Exits: map[string]ExitConfig{
 			"us": {
-				Provider: "aws",
+				Provider: "direct",
 				Country:  "US",
 			},
 		},
 	}
 
-	resolver := &ConfigExitResolver{Config: config}
+	resolver := NewConfigExitResolver(config)
 
 	// Test nil exit
 	name, cfg, err := resolver.Resolve(nil)
@@ -269,8 +454,8 @@ func TestConfigExitResolver_Resolve_Default(t *testing.T) {
 		t.Errorf("expected exit name 'us', got '%s'", name)
 	}
 
-	if cfg.Provider != "aws" {
-		t.Errorf("expected provider 'aws', got '%s'", cfg.Provider)
+	if cfg.Provider != "direct" {
+		t.Errorf("expected provider 'direct', got '%s'", cfg.Provider)
 	}
 
 	// Test empty exit name
@@ -289,17 +474,17 @@ func TestConfigExitResolver_Resolve_NamedExit(t *testing.T) {
 		DefaultExit: "us",
 		Exits: map[string]ExitConfig{
 			"us": {
-				Provider: "aws",
+				Provider: "direct",
 				Country:  "US",
 			},
 			"de": {
-				Provider: "gcp",
+				Provider: "direct",
 				Country:  "DE",
 			},
 		},
 	}
 
-	resolver := &ConfigExitResolver{Config: config}
+	resolver := NewConfigExitResolver(config)
 
 	name, cfg, err := resolver.Resolve(&types.Exit{Name: "de"})
 	if err != nil {
@@ -320,13 +505,13 @@ func TestConfigExitResolver_Resolve_UnknownExit(t *testing.T) {
 		DefaultExit: "us",
 		Exits: map[string]ExitConfig{
 			"us": {
-				Provider: "aws",
+				Provider: "direct",
 				Country:  "US",
 			},
 		},
 	}
 
-	resolver := &ConfigExitResolver{Config: config}
+	resolver := NewConfigExitResolver(config)
 
 	_, _, err := resolver.Resolve(&types.Exit{Name: "nonexistent"})
 	if err == nil {
@@ -340,11 +525,11 @@ func TestLoadConfig_CaseSensitivity(t *testing.T) {
 		DefaultExit: "US",
 		Exits: map[string]ExitConfig{
 			"US": {
-				Provider: "aws",
+				Provider: "direct",
 				Country:  "US",
 			},
 			"De": {
-				Provider: "gcp",
+				Provider: "direct",
 				Country:  "DE",
 			},
 		},
@@ -363,3 +548,213 @@ func TestLoadConfig_CaseSensitivity(t *testing.T) {
 		t.Error("expected to find exit with original case 'US'")
 	}
 }
+
+func TestLoadConfig_IdleTimeoutDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, `default_exit: kr
+idle_timeout: 15m
+exits:
+  kr:
+    provider: direct
+    country: Korea
+  uk:
+    provider: direct
+    country: United Kingdom
+    idle_timeout: 1h
+`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	if kr, _ := config.GetExit("kr"); kr.IdleTimeout != 15*time.Minute {
+		t.Errorf("expected kr to inherit idle_timeout 15m, got %v", kr.IdleTimeout)
+	}
+	if uk, _ := config.GetExit("uk"); uk.IdleTimeout != time.Hour {
+		t.Errorf("expected uk idle_timeout 1h, got %v", uk.IdleTimeout)
+	}
+}
+
+func TestConfig_Validate_NegativeIdleTimeout(t *testing.T) {
+	config := &Config{
+		DefaultExit: "kr",
+		Exits: map[string]ExitConfig{
+			"kr": {Provider: "direct", Country: "Korea", IdleTimeout: -time.Minute},
+		},
+	}
+
+	if err := config.Validate(); err == nil {
+		t.Fatal("expected error for negative idle_timeout, got nil")
+	}
+}
+
+func TestConfig_Validate_HealthSettings(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*ExitConfig)
+	}{
+		{"negative startup_timeout", func(e *ExitConfig) { e.StartupTimeout = -time.Second }},
+		{"negative health_poll_interval", func(e *ExitConfig) { e.HealthPollInterval = -time.Second }},
+		{"relative probe_url", func(e *ExitConfig) { e.ProbeURL = "/ip" }},
+		{"unknown missing_healthcheck", func(e *ExitConfig) { e.MissingHealthcheck = "ignore" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exit := ExitConfig{Provider: "direct", Country: "Korea"}
+			tt.modify(&exit)
+
+			config := &Config{DefaultExit: "kr", Exits: map[string]ExitConfig{"kr": exit}}
+			if err := config.Validate(); err == nil {
+				t.Fatal("expected validation error, got nil")
+			}
+		})
+	}
+}
+
+func TestExitConfig_PoolMembers(t *testing.T) {
+	exit := ExitConfig{
+		Provider: "gluetun",
+		Country:  "Korea",
+		Replicas: 3,
+		Gluetun:  &GluetunSettings{ServiceProvider: "nordvpn", OpenVPNUser: "user"},
+	}
+
+	members := exit.PoolMembers("kr")
+	if len(members) != 3 {
+		t.Fatalf("expected 3 members, got %d", len(members))
+	}
+
+	for i, member := range members {
+		if want := fmt.Sprintf("kr-%d", i+1); member.Name != want {
+			t.Errorf("expected member name '%s', got '%s'", want, member.Name)
+		}
+		if member.Exit.IsPool() || member.Exit.Gluetun == nil || member.Exit.Country != "Korea" {
+			t.Errorf("unexpected member exit: %+v", member.Exit)
+		}
+	}
+
+	if single := (ExitConfig{Replicas: 1}).PoolMembers("kr"); single != nil {
+		t.Errorf("expected a single replica not to be a pool, got %v", single)
+	}
+}
+
+func TestConfig_Validate_PoolSettings(t *testing.T) {
+	settings := GluetunSettings{ServiceProvider: "nordvpn", OpenVPNUser: "user"}
+
+	tests := []struct {
+		name  string
+		exits map[string]ExitConfig
+	}{
+		{"members with gluetun", map[string]ExitConfig{
+			"kr": {Provider: "gluetun", Country: "Korea", Gluetun: &settings, Members: []GluetunSettings{settings}},
+		}},
+		{"invalid member", map[string]ExitConfig{
+			"kr": {Provider: "gluetun", Country: "Korea", Members: []GluetunSettings{{}}},
+		}},
+		{"replicas on direct exit", map[string]ExitConfig{
+			"kr": {Provider: "direct", Country: "Korea", Replicas: 2},
+		}},
+		{"unknown balance", map[string]ExitConfig{
+			"kr": {Provider: "gluetun", Country: "Korea", Gluetun: &settings, Replicas: 2, Balance: "random"},
+		}},
+		{"min_ready without pool", map[string]ExitConfig{
+			"kr": {Provider: "gluetun", Country: "Korea", Gluetun: &settings, MinReady: 1},
+		}},
+		{"min_ready above replicas", map[string]ExitConfig{
+			"kr": {Provider: "gluetun", Country: "Korea", Gluetun: &settings, Replicas: 2, MinReady: 3},
+		}},
+		{"negative min_ready", map[string]ExitConfig{
+			"kr": {Provider: "gluetun", Country: "Korea", Gluetun: &settings, Replicas: 2, MinReady: -1},
+		}},
+		{"min_ready on direct exit", map[string]ExitConfig{
+			"kr": {Provider: "direct", Country: "Korea", MinReady: 1},
+		}},
+		{"member name clash", map[string]ExitConfig{
+			"kr":   {Provider: "gluetun", Country: "Korea", Gluetun: &settings, Replicas: 2},
+			"kr-2": {Provider: "direct", Country: "Korea"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{DefaultExit: "kr", Exits: tt.exits}
+			if err := config.Validate(); err == nil {
+				t.Fatal("expected validation error, got nil")
+			}
+		})
+	}
+}
+
+func TestConfigExitResolver_ResolveChain(t *testing.T) {
+	config := &Config{
+		DefaultExit:    "us",
+		FallbackPolicy: FallbackDefault,
+		Exits: map[string]ExitConfig{
+			"us": {Provider: "direct", Country: "US"},
+			"fr": {Provider: "direct", Country: "FR", Fallback: []string{"uk", "us"}},
+			"uk": {Provider: "direct", Country: "UK"},
+		},
+	}
+
+	chain, err := NewConfigExitResolver(config).ResolveChain(&types.Exit{Name: "fr"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var names []string
+	for _, exit := range chain {
+		names = append(names, exit.Name)
+	}
+	if len(names) != 3 || names[0] != "fr" || names[1] != "uk" || names[2] != "us" {
+		t.Errorf("expected chain [fr uk us], got %v", names)
+	}
+}
+
+func TestConfig_Validate_UnknownFallback(t *testing.T) {
+	config := &Config{
+		DefaultExit: "kr",
+		Exits: map[string]ExitConfig{
+			"kr": {Provider: "direct", Country: "Korea", Fallback: []string{"jp"}},
+		},
+	}
+
+	if err := config.Validate(); err == nil {
+		t.Fatal("expected error for unknown fallback exit, got nil")
+	}
+}
+
+func TestConfig_Validate_ProxyAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		auth    ProxyAuthConfig
+		wantErr bool
+	}{
+		{"disabled", ProxyAuthConfig{}, false},
+		{"default pattern", ProxyAuthConfig{Users: map[string]string{"alice": "s3cret"}}, false},
+		{"custom pattern", ProxyAuthConfig{Pattern: "<user>.<exit>", Users: map[string]string{"alice": "s3cret"}}, false},
+		{"required without users", ProxyAuthConfig{Required: true}, true},
+		{"pattern without exit", ProxyAuthConfig{Pattern: "<user>-exit", Users: map[string]string{"alice": "s3cret"}}, true},
+		{"pattern with colon", ProxyAuthConfig{Pattern: "<user>:<exit>", Users: map[string]string{"alice": "s3cret"}}, true},
+		{"username with colon", ProxyAuthConfig{Users: map[string]string{"al:ice": "s3cret"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				DefaultExit: "kr",
+				Exits:       map[string]ExitConfig{"kr": {Provider: "direct", Country: "Korea"}},
+				ProxyAuth:   tt.auth,
+			}
+
+			err := config.Validate()
+			if tt.wantErr && err == nil {
+				t.Fatal("expected validation error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
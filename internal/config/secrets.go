@@ -0,0 +1,198 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// secretRefPattern matches secret references such as ${env:NAME},
+// ${file:/run/secrets/x} or ${secret:x} inside a config string.
+var secretRefPattern = regexp.MustCompile(`\$\{(env|file|secret):([^}]*)\}`)
+
+// secretsDir is where ${secret:name} references are read from (Docker and Compose secrets).
+var secretsDir = "/run/secrets"
+
+// secretResolver substitutes secret references in config strings and remembers
+// every resolved value so it can be kept out of errors.
+type secretResolver struct {
+	values []string
+}
+
+// resolveSecrets replaces secret references in every string field reachable from v,
+// which must be a pointer. Errors name the field and reference, never the value.
+func resolveSecrets(v any) (*secretResolver, error) {
+	r := &secretResolver{}
+	return r, r.resolveValue(reflect.ValueOf(v), "")
+}
+
+func (r *secretResolver) resolveValue(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.String:
+		resolved, err := r.resolveString(v.String())
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		v.SetString(resolved)
+
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return r.resolveValue(v.Elem(), path)
+		}
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := range t.NumField() {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if err := r.resolveValue(v.Field(i), joinPath(path, yamlName(field))); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice:
+		for i := range v.Len() {
+			if err := r.resolveValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		// Map values are not addressable, so resolve a copy and store it back
+		for _, key := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			if err := r.resolveValue(elem, joinPath(path, fmt.Sprint(key.Interface()))); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+	}
+
+	return nil
+}
+
+// resolveString substitutes every secret reference in s.
+func (r *secretResolver) resolveString(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var errs []error
+	resolved := secretRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		m := secretRefPattern.FindStringSubmatch(ref)
+		value, err := lookupSecret(m[1], m[2])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot resolve %s: %w", ref, err))
+			return ""
+		}
+		if value != "" {
+			r.values = append(r.values, value)
+		}
+		return value
+	})
+
+	if err := errors.Join(errs...); err != nil {
+		return "", err
+	}
+	return resolved, nil
+}
+
+// lookupSecret returns the value a single reference points to.
+func lookupSecret(scheme, name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("empty reference")
+	}
+
+	switch scheme {
+	case "env":
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable is not set")
+		}
+		return value, nil
+
+	case "file":
+		return readSecretFile(name)
+
+	case "secret":
+		if strings.ContainsRune(name, '/') {
+			return "", fmt.Errorf("secret name must not contain '/'")
+		}
+		return readSecretFile(filepath.Join(secretsDir, name))
+	}
+
+	return "", fmt.Errorf("unknown reference type '%s'", scheme)
+}
+
+// resolvePasswordFiles reads the password_file of every exit that has no
+// password, in the same way as a ${file:...} reference.
+func (r *secretResolver) resolvePasswordFiles(c *Config) error {
+	for name, exit := range c.Exits {
+		if exit.Password != "" || exit.PasswordFile == "" {
+			continue
+		}
+
+		password, err := readSecretFile(exit.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("exits.%s.password_file: cannot read password: %w", name, err)
+		}
+		if password != "" {
+			r.values = append(r.values, password)
+		}
+
+		exit.Password = password
+		c.Exits[name] = exit
+	}
+	return nil
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// The path is part of the reference, but the OS error is enough context
+		return "", errors.Unwrap(err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// redact returns err with every resolved secret value replaced, or err itself
+// if it contains none.
+func (r *secretResolver) redact(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	msg := err.Error()
+	redacted := msg
+	for _, value := range r.values {
+		redacted = strings.ReplaceAll(redacted, value, "[redacted]")
+	}
+
+	if redacted == msg {
+		return err
+	}
+	return errors.New(redacted)
+}
+
+// yamlName returns the YAML key of a struct field.
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+func joinPath(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+	return parent + "." + child
+}
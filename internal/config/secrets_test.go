@@ -0,0 +1,153 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_ResolvesSecretReferences(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Setenv("GEOSWITCH_TEST_VPN_USER", "env-user")
+
+	passwordFile := filepath.Join(dir, "vpn-password")
+	writeConfigFile(t, passwordFile, "file-password\n")
+
+	oldSecretsDir := secretsDir
+	secretsDir = dir
+	t.Cleanup(func() { secretsDir = oldSecretsDir })
+	writeConfigFile(t, filepath.Join(dir, "wg-key"), "secret-key")
+
+	path := filepath.Join(dir, "config.yaml")
+	writeConfigFile(t, path, `default_exit: kr
+exits:
+  kr:
+    provider: gluetun
+    country: Korea
+    gluetun:
+      vpn_service_provider: nordvpn
+      openvpn_user: ${env:GEOSWITCH_TEST_VPN_USER}
+      openvpn_password: ${file:`+passwordFile+`}
+      env:
+        EXTRA: prefix-${secret:wg-key}
+`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	g := config.Exits["kr"].Gluetun
+	if g.OpenVPNUser != "env-user" {
+		t.Errorf("expected openvpn_user 'env-user', got '%s'", g.OpenVPNUser)
+	}
+	if g.OpenVPNPassword != "file-password" {
+		t.Errorf("expected openvpn_password 'file-password', got '%s'", g.OpenVPNPassword)
+	}
+	if g.Env["EXTRA"] != "prefix-secret-key" {
+		t.Errorf("expected env EXTRA 'prefix-secret-key', got '%s'", g.Env["EXTRA"])
+	}
+}
+
+func TestLoadConfig_ReadsPasswordFile(t *testing.T) {
+	dir := t.TempDir()
+
+	passwordFile := filepath.Join(dir, "password")
+	writeConfigFile(t, passwordFile, "from-file\n")
+
+	path := filepath.Join(dir, "config.yaml")
+	writeConfigFile(t, path, `default_exit: proxy
+exits:
+  proxy:
+    provider: http
+    country: DE
+    url: http://proxy.example.com:3128
+    username: bob
+    password_file: `+passwordFile+`
+`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := config.Exits["proxy"].Password; got != "from-file" {
+		t.Errorf("expected password 'from-file', got '%s'", got)
+	}
+
+	// A changed file changes the exit, so reloads pick it up
+	writeConfigFile(t, passwordFile, "rotated\n")
+	config, err = LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := config.Exits["proxy"].Password; got != "rotated" {
+		t.Errorf("expected password 'rotated', got '%s'", got)
+	}
+}
+
+func TestLoadConfig_MissingPasswordFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, `default_exit: proxy
+exits:
+  proxy:
+    provider: http
+    country: DE
+    url: http://proxy.example.com:3128
+    password_file: /nonexistent/password
+`)
+
+	_, err := LoadConfig(path)
+	if err == nil {
+		t.Fatal("expected error for missing password file, got nil")
+	}
+	if !strings.Contains(err.Error(), "exits.proxy.password_file") {
+		t.Errorf("expected error to name the field, got '%s'", err.Error())
+	}
+}
+
+func TestLoadConfig_MissingSecretReference(t *testing.T) {
+	os.Unsetenv("GEOSWITCH_TEST_MISSING")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, `default_exit: proxy
+exits:
+  proxy:
+    provider: http
+    country: DE
+    url: http://proxy.example.com:3128
+    password: ${env:GEOSWITCH_TEST_MISSING}
+`)
+
+	_, err := LoadConfig(path)
+	if err == nil {
+		t.Fatal("expected error for unset environment variable, got nil")
+	}
+
+	if !strings.Contains(err.Error(), "exits.proxy.password") {
+		t.Errorf("expected error to name the field, got '%s'", err.Error())
+	}
+}
+
+func TestLoadConfig_ValidationErrorRedactsSecrets(t *testing.T) {
+	t.Setenv("GEOSWITCH_TEST_SOURCE_IP", "super-secret-value")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, `default_exit: home
+exits:
+  home:
+    provider: direct
+    country: US
+    source_ip: ${env:GEOSWITCH_TEST_SOURCE_IP}
+`)
+
+	_, err := LoadConfig(path)
+	if err == nil {
+		t.Fatal("expected validation error, got nil")
+	}
+
+	if strings.Contains(err.Error(), "super-secret-value") {
+		t.Errorf("expected secret value to be redacted, got '%s'", err.Error())
+	}
+}
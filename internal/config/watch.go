@@ -0,0 +1,215 @@
+package config
+
+import (
+	"context"
+	"log"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ReloadFunc is called after a new configuration has been activated.
+// old is the configuration that was replaced.
+type ReloadFunc func(old, new *Config)
+
+// CheckFunc is called with a new configuration before it is activated.
+// Returning an error rejects the reload.
+type CheckFunc func(new *Config) error
+
+// Watcher reloads a configuration file into a ConfigExitResolver when the
+// file changes on disk, or when Reload is called explicitly (e.g. on SIGHUP).
+// A file that fails to load or validate is rejected and the active config is kept.
+type Watcher struct {
+	path     string
+	resolver *ConfigExitResolver
+	interval time.Duration
+	onReload []ReloadFunc
+	checks   []CheckFunc
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// WatcherOption is a functional option for configuring a Watcher.
+type WatcherOption func(*Watcher)
+
+// WithPollInterval sets how often the file is checked for changes.
+// A zero interval disables polling; only explicit Reload calls apply changes.
+// If not provided, defaults to 5 seconds.
+func WithPollInterval(interval time.Duration) WatcherOption {
+	return func(w *Watcher) {
+		w.interval = interval
+	}
+}
+
+// OnReload registers a callback invoked after each successful reload.
+func OnReload(fn ReloadFunc) WatcherOption {
+	return func(w *Watcher) {
+		w.onReload = append(w.onReload, fn)
+	}
+}
+
+// BeforeReload registers a check run on each new configuration before it is
+// activated, e.g. to set up a provider the new config needs. If it fails, the
+// reload is rejected and the active config is kept.
+func BeforeReload(fn CheckFunc) WatcherOption {
+	return func(w *Watcher) {
+		w.checks = append(w.checks, fn)
+	}
+}
+
+// NewWatcher returns a Watcher for the file at path. The resolver is expected
+// to already hold the configuration currently loaded from that file.
+func NewWatcher(path string, resolver *ConfigExitResolver, opts ...WatcherOption) *Watcher {
+	w := &Watcher{
+		path:     path,
+		resolver: resolver,
+		interval: 5 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		w.modTime = info.ModTime()
+		w.size = info.Size()
+	}
+
+	return w
+}
+
+// Run polls the configuration file until ctx is cancelled, reloading it whenever
+// its modification time or size changes.
+func (w *Watcher) Run(ctx context.Context) {
+	if w.interval <= 0 {
+		log.Printf("[config] file polling disabled for %s", w.path)
+		return
+	}
+
+	log.Printf("[config] watching %s for changes every %s", w.path, w.interval)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if w.changed() {
+				log.Printf("[config] detected change in %s", w.path)
+				w.Reload()
+			}
+		}
+	}
+}
+
+// Reload loads and validates the configuration file and, if it is valid,
+// atomically swaps it into the resolver. On error the active config is kept.
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if info, err := os.Stat(w.path); err == nil {
+		w.modTime = info.ModTime()
+		w.size = info.Size()
+	}
+
+	cfg, err := LoadConfig(w.path)
+	if err != nil {
+		log.Printf("[config] rejected new configuration, keeping active config: %v", err)
+		return err
+	}
+
+	for _, check := range w.checks {
+		if err := check(cfg); err != nil {
+			log.Printf("[config] rejected new configuration, keeping active config: %v", err)
+			return err
+		}
+	}
+
+	old := w.resolver.Store(cfg)
+	log.Printf("[config] activated new configuration with %d exits", len(cfg.Exits))
+
+	for _, fn := range w.onReload {
+		fn(old, cfg)
+	}
+
+	return nil
+}
+
+// changed reports whether the file differs from the last observed state.
+func (w *Watcher) changed() bool {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		log.Printf("[config] failed to stat %s: %v", w.path, err)
+		return false
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return !info.ModTime().Equal(w.modTime) || info.Size() != w.size
+}
+
+// ChangedExits returns the names of exits that were added, removed, or whose
+// settings differ between the two configurations in a way that requires the
+// exit to be restarted. Exits whose settings differ only in those that apply
+// without a restart are reported by ReconfiguredExits instead.
+func ChangedExits(old, new *Config) []string {
+	if old == nil {
+		return nil
+	}
+
+	var changed []string
+	for name, exit := range old.Exits {
+		next, ok := new.GetExit(name)
+		if !ok || !reflect.DeepEqual(exit.restartSettings(), next.restartSettings()) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range new.Exits {
+		if _, ok := old.GetExit(name); !ok {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// ReconfiguredExits returns the names of exits in both configurations whose
+// settings differ only in those that apply to a running exit without a
+// restart, such as fallback, eager or idle_timeout.
+func ReconfiguredExits(old, new *Config) []string {
+	if old == nil {
+		return nil
+	}
+
+	var reconfigured []string
+	for name, exit := range old.Exits {
+		next, ok := new.GetExit(name)
+		if ok && !reflect.DeepEqual(exit, next) &&
+			reflect.DeepEqual(exit.restartSettings(), next.restartSettings()) {
+			reconfigured = append(reconfigured, name)
+		}
+	}
+	return reconfigured
+}
+
+// restartSettings returns e without the settings that apply to a running exit
+// without a restart. They only affect routing, starting the exit, or how long
+// it is kept running. probe_url and verify_country stay, as they vouch for the
+// tunnel that is up and must be checked against it by a restart.
+func (e ExitConfig) restartSettings() ExitConfig {
+	e.Balance = ""
+	e.MinReady = 0
+	e.StartupTimeout = 0
+	e.HealthPollInterval = 0
+	e.MissingHealthcheck = ""
+	e.IdleTimeout = 0
+	e.Fallback = nil
+	e.Eager = false
+	return e
+}
@@ -0,0 +1,220 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+}
+
+func TestWatcher_Reload_SwapsConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, "default_exit: kr\nexits:\n  kr:\n    provider: direct\n    country: Korea\n")
+
+	initial, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resolver := NewConfigExitResolver(initial)
+
+	var gotOld, gotNew *Config
+	watcher := NewWatcher(path, resolver, WithPollInterval(0), OnReload(func(old, new *Config) {
+		gotOld, gotNew = old, new
+	}))
+
+	writeConfigFile(t, path, "default_exit: uk\nexits:\n  uk:\n    provider: direct\n    country: United Kingdom\n")
+
+	if err := watcher.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if resolver.Config().DefaultExit != "uk" {
+		t.Errorf("expected default exit 'uk', got '%s'", resolver.Config().DefaultExit)
+	}
+
+	if gotOld != initial {
+		t.Error("expected reload callback to receive the previous config")
+	}
+
+	if gotNew != resolver.Config() {
+		t.Error("expected reload callback to receive the active config")
+	}
+}
+
+func TestWatcher_Reload_InvalidConfigKeepsActive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, "default_exit: kr\nexits:\n  kr:\n    provider: direct\n    country: Korea\n")
+
+	initial, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resolver := NewConfigExitResolver(initial)
+
+	called := false
+	watcher := NewWatcher(path, resolver, WithPollInterval(0), OnReload(func(old, new *Config) {
+		called = true
+	}))
+
+	writeConfigFile(t, path, "default_exit: missing\nexits:\n  kr:\n    provider: direct\n    country: Korea\n")
+
+	if err := watcher.Reload(); err == nil {
+		t.Fatal("expected error for invalid config, got nil")
+	}
+
+	if resolver.Config() != initial {
+		t.Error("expected active config to be kept after invalid reload")
+	}
+
+	if called {
+		t.Error("expected reload callback not to be invoked")
+	}
+}
+
+func TestWatcher_Reload_BeforeReloadRejects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, "default_exit: kr\nexits:\n  kr:\n    provider: direct\n    country: Korea\n")
+
+	initial, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resolver := NewConfigExitResolver(initial)
+
+	var checked *Config
+	called := false
+	watcher := NewWatcher(path, resolver, WithPollInterval(0),
+		BeforeReload(func(new *Config) error {
+			checked = new
+			if new.UsesProvider(ProviderSOCKS5) {
+				return errors.New("socks5 unavailable")
+			}
+			return nil
+		}),
+		OnReload(func(old, new *Config) {
+			called = true
+		}),
+	)
+
+	writeConfigFile(t, path, "default_exit: kr\nexits:\n  kr:\n    provider: socks5\n    country: Korea\n    address: 127.0.0.1:1080\n")
+
+	if err := watcher.Reload(); err == nil {
+		t.Fatal("expected error from failed check, got nil")
+	}
+	if checked == nil || checked.Exits["kr"].Provider != ProviderSOCKS5 {
+		t.Error("expected check to receive the new config")
+	}
+	if resolver.Config() != initial {
+		t.Error("expected active config to be kept after rejected reload")
+	}
+	if called {
+		t.Error("expected reload callback not to be invoked")
+	}
+
+	writeConfigFile(t, path, "default_exit: uk\nexits:\n  uk:\n    provider: direct\n    country: United Kingdom\n")
+
+	if err := watcher.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolver.Config().DefaultExit != "uk" {
+		t.Errorf("expected default exit 'uk', got '%s'", resolver.Config().DefaultExit)
+	}
+}
+
+func TestChangedExits(t *testing.T) {
+	old := &Config{
+		DefaultExit: "kr",
+		Exits: map[string]ExitConfig{
+			"kr": {Provider: "gluetun", Country: "Korea"},
+			"uk": {Provider: "gluetun", Country: "United Kingdom"},
+			"de": {Provider: "gluetun", Country: "Germany"},
+			"us": {Provider: "gluetun", Country: "United States"},
+		},
+	}
+
+	new := &Config{
+		DefaultExit: "kr",
+		Exits: map[string]ExitConfig{
+			"kr": {Provider: "gluetun", Country: "Korea"},
+			"uk": {Provider: "gluetun", Country: "Ireland"},
+			"fr": {Provider: "gluetun", Country: "France", Eager: true},
+			"us": {Provider: "gluetun", Country: "United States", Fallback: []string{"kr"}, IdleTimeout: time.Minute},
+		},
+	}
+
+	got := ChangedExits(old, new)
+	sort.Strings(got)
+
+	if len(got) != 3 || got[0] != "de" || got[1] != "fr" || got[2] != "uk" {
+		t.Errorf("expected changed exits [de fr uk], got %v", got)
+	}
+}
+
+func TestReconfiguredExits(t *testing.T) {
+	old := &Config{
+		DefaultExit: "kr",
+		Exits: map[string]ExitConfig{
+			"kr": {Provider: "gluetun", Country: "Korea"},
+			"uk": {Provider: "gluetun", Country: "United Kingdom"},
+			"us": {Provider: "gluetun", Country: "United States", Replicas: 2},
+			"de": {Provider: "gluetun", Country: "Germany"},
+		},
+	}
+
+	new := &Config{
+		DefaultExit: "kr",
+		Exits: map[string]ExitConfig{
+			"kr": {Provider: "gluetun", Country: "Korea"},
+			"uk": {Provider: "gluetun", Country: "Ireland", Eager: true},
+			"us": {Provider: "gluetun", Country: "United States", Replicas: 2, Balance: BalanceLeastConn, MinReady: 1},
+			"de": {Provider: "gluetun", Country: "Germany", Eager: true, IdleTimeout: time.Minute},
+		},
+	}
+
+	got := ReconfiguredExits(old, new)
+	sort.Strings(got)
+
+	if len(got) != 2 || got[0] != "de" || got[1] != "us" {
+		t.Errorf("expected reconfigured exits [de us], got %v", got)
+	}
+}
+
+func TestChangedExits_VerificationNeedsRestart(t *testing.T) {
+	old := &Config{
+		DefaultExit: "kr",
+		Exits: map[string]ExitConfig{
+			"kr": {Provider: "gluetun", Country: "Korea"},
+			"uk": {Provider: "gluetun", Country: "United Kingdom"},
+		},
+	}
+
+	new := &Config{
+		DefaultExit: "kr",
+		Exits: map[string]ExitConfig{
+			"kr": {Provider: "gluetun", Country: "Korea", VerifyCountry: true},
+			"uk": {Provider: "gluetun", Country: "United Kingdom", ProbeURL: "https://ifconfig.co/json"},
+		},
+	}
+
+	got := ChangedExits(old, new)
+	sort.Strings(got)
+
+	if len(got) != 2 || got[0] != "kr" || got[1] != "uk" {
+		t.Errorf("expected changed exits [kr uk], got %v", got)
+	}
+	if reconfigured := ReconfiguredExits(old, new); len(reconfigured) != 0 {
+		t.Errorf("expected no reconfigured exits, got %v", reconfigured)
+	}
+}
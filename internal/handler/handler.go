@@ -1,17 +1,27 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 
 	"geoswitch/internal/config"
 	"geoswitch/internal/provider"
 )
 
+// HeaderExitUsed reports the exit that served a request, which differs from
+// the requested one when the request fell back to another exit.
+const HeaderExitUsed = "X-GeoSwitch-Exit-Used"
+
 // NewProxyHandler returns an http.Handler that resolves the target for
 // each incoming request using the provided TargetResolver. It rewrites the
 // incoming request to point to the resolved target and delegates to the
-// provided proxyHandler for actual proxying.
+// provided proxyHandler for actual proxying. CONNECT requests are passed on
+// with the host:port to tunnel to as their Host, for the exit's handler to
+// open the tunnel.
 func NewProxyHandler(
 	resolver *config.ConfigExitResolver,
 	provider provider.ExitHandlerProvider,
@@ -25,6 +35,11 @@ func NewProxyHandler(
 			r,
 			parsers...,
 		)
+		if errors.Is(err, ErrProxyAuth) {
+			writer.Header().Set("Proxy-Authenticate", `Basic realm="geoswitch"`)
+			http.Error(writer, "Proxy authentication required", http.StatusProxyAuthRequired)
+			return
+		}
 		if err != nil {
 			log.Printf("[handler] error parsing request intent: %v", err)
 			http.Error(writer, "Error parsing request intent", http.StatusBadRequest)
@@ -38,8 +53,14 @@ func NewProxyHandler(
 			http.Error(writer, "No target resolved", http.StatusBadRequest)
 			return
 		}
-		// Raise error if target is not absolute URL
-		if target.Scheme != "http" && target.Scheme != "https" {
+		// Raise error if target is not absolute URL, or host:port for tunnels
+		if r.Method == http.MethodConnect {
+			if _, _, err := net.SplitHostPort(target.Host); err != nil || target.Scheme != "" {
+				log.Printf("[handler] invalid tunnel target: %s", target.String())
+				http.Error(writer, "Invalid tunnel target", http.StatusBadRequest)
+				return
+			}
+		} else if target.Scheme != "http" && target.Scheme != "https" {
 			log.Printf("[handler] unsupported URL scheme: %s", target.String())
 			http.Error(writer, "Unsupported URL scheme", http.StatusBadRequest)
 			return
@@ -47,45 +68,79 @@ func NewProxyHandler(
 
 		log.Printf("[handler] resolved target: %s", target.String())
 
-		// Extract exit from context
-		exitName, exitCfg, err := resolver.Resolve(ctx.Exit)
+		// Extract exit from context, along with the exits to fall back to
+		chain, err := resolver.ResolveChain(ctx.Exit)
 		if err != nil {
-			log.Printf("[handler] exit '%s' resolution failed: %v", exitName, err)
+			log.Printf("[handler] exit resolution failed: %v", err)
 			http.Error(writer, "Unknown or unavailable exit", http.StatusBadRequest)
 			return
 		}
 
-		log.Printf(
-			"[handler] resolved exit '%s' (provider=%s, country=%s)",
-			exitName,
-			exitCfg.Provider,
-			exitCfg.Country,
-		)
+		var proxy http.Handler
+		var exitName string
+		for i, exit := range chain {
+			log.Printf(
+				"[handler] resolved exit '%s' (provider=%s, country=%s)",
+				exit.Name,
+				exit.Config.Provider,
+				exit.Config.Country,
+			)
 
-		proxy, err := provider.GetHandler(r.Context(), exitName, exitCfg)
-		if err != nil {
-			log.Printf("[handler] no proxy found for exit: %s", exitName)
+			proxy, err = provider.GetHandler(r.Context(), exit.Name, exit.Config)
+			if err == nil {
+				exitName = exit.Name
+				break
+			}
+
+			log.Printf("[handler] no proxy found for exit '%s': %v", exit.Name, err)
+			if r.Context().Err() != nil {
+				break // client gave up, don't start fallbacks for nobody
+			}
+			if i+1 < len(chain) {
+				log.Printf("[handler] falling back from exit '%s' to '%s'", exit.Name, chain[i+1].Name)
+			}
+		}
+		if proxy == nil {
 			http.Error(writer, "Exit unavailable", http.StatusBadGateway)
 			return
 		}
 
 		log.Printf("[handler] selected exit: %s", exitName)
+		writer.Header().Set(HeaderExitUsed, exitName)
 
 		if len(ctx.RemainingPath) > 0 {
 			log.Printf("[handler] warning: unconsumed path segments: %v", ctx.RemainingPath)
 		}
 
-		req := r.Clone(r.Context())
-		req.URL.Scheme = target.Scheme
-		req.URL.Host = target.Host
-		req.URL.Path = target.Path
-		req.URL.RawQuery = target.RawQuery
-		req.URL.Fragment = ""
+		req := r.Clone(withSession(r.Context(), ctx.Session))
+		if r.Method == http.MethodConnect {
+			// Exit handlers open the tunnel to req.Host
+			req.URL = &url.URL{Host: target.Host}
+		} else {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path = target.Path
+			req.URL.RawQuery = target.RawQuery
+			req.URL.Fragment = ""
+		}
 		req.Host = target.Host
 		req.RequestURI = ""
 
+		// Meant for GeoSwitch when used as a forward proxy, never for the target
+		req.Header.Del("Proxy-Authorization")
+		req.Header.Del("Proxy-Connection")
+		stripCookies(req.Header, ctx.consumedCookies)
+
 		log.Printf("[handler] proxying to %s", req.URL.String())
 
 		proxy.ServeHTTP(writer, req)
 	})
 }
+
+// withSession passes the session requested by the client on to the exit's provider.
+func withSession(ctx context.Context, session string) context.Context {
+	if session == "" {
+		return ctx
+	}
+	return provider.WithSession(ctx, session)
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"encoding/base64"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -23,9 +24,7 @@ func TestNewProxyHandler_HappyPath_UsesDefaultExit(t *testing.T) {
 		},
 	}
 
-	resolver := &config.ConfigExitResolver{
-		Config: cfg,
-	}
+	resolver := config.NewConfigExitResolver(cfg)
 
 	proxies := map[string]http.Handler{
 		"default": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -94,9 +93,7 @@ func TestNewProxyHandler_UsesHeaderExitWhenPresent(t *testing.T) {
 		},
 	}
 
-	resolver := &config.ConfigExitResolver{
-		Config: cfg,
-	}
+	resolver := config.NewConfigExitResolver(cfg)
 
 	proxies := map[string]http.Handler{
 		"default": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -142,9 +139,7 @@ func TestNewProxyHandler_ParseErrorReturnsBadRequest(t *testing.T) {
 		},
 	}
 
-	resolver := &config.ConfigExitResolver{
-		Config: cfg,
-	}
+	resolver := config.NewConfigExitResolver(cfg)
 
 	proxies := map[string]http.Handler{
 		"default": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -187,9 +182,7 @@ func TestNewProxyHandler_NoTargetReturnsBadRequest(t *testing.T) {
 		},
 	}
 
-	resolver := &config.ConfigExitResolver{
-		Config: cfg,
-	}
+	resolver := config.NewConfigExitResolver(cfg)
 
 	proxies := map[string]http.Handler{
 		"default": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -221,9 +214,7 @@ func TestNewProxyHandler_UnsupportedSchemeReturnsBadRequest(t *testing.T) {
 		},
 	}
 
-	resolver := &config.ConfigExitResolver{
-		Config: cfg,
-	}
+	resolver := config.NewConfigExitResolver(cfg)
 
 	proxies := map[string]http.Handler{
 		"default": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -258,9 +249,7 @@ func TestNewProxyHandler_UnknownExitReturnsBadRequest(t *testing.T) {
 		},
 	}
 
-	resolver := &config.ConfigExitResolver{
-		Config: cfg,
-	}
+	resolver := config.NewConfigExitResolver(cfg)
 
 	proxies := map[string]http.Handler{
 		"default": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -299,9 +288,7 @@ func TestNewProxyHandler_MissingProxyForExit(t *testing.T) {
 		},
 	}
 
-	resolver := &config.ConfigExitResolver{
-		Config: cfg,
-	}
+	resolver := config.NewConfigExitResolver(cfg)
 
 	// Only provide proxy for "default", not "missing-proxy"
 	proxies := map[string]http.Handler{
@@ -339,9 +326,7 @@ func TestNewProxyHandler_HTTPSScheme(t *testing.T) {
 		},
 	}
 
-	resolver := &config.ConfigExitResolver{
-		Config: cfg,
-	}
+	resolver := config.NewConfigExitResolver(cfg)
 
 	proxies := map[string]http.Handler{
 		"default": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -391,9 +376,7 @@ func TestNewProxyHandler_PreservesHTTPMethod(t *testing.T) {
 				},
 			}
 
-			resolver := &config.ConfigExitResolver{
-				Config: cfg,
-			}
+			resolver := config.NewConfigExitResolver(cfg)
 
 			proxies := map[string]http.Handler{
 				"default": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -419,3 +402,276 @@ func TestNewProxyHandler_PreservesHTTPMethod(t *testing.T) {
 		})
 	}
 }
+
+func TestNewProxyHandler_FallsBackToNextExit(t *testing.T) {
+	cfg := &config.Config{
+		DefaultExit: "default",
+		Exits: map[string]config.ExitConfig{
+			"default": {Provider: "test", Country: "US"},
+			"fr":      {Provider: "test", Country: "FR", Fallback: []string{"uk", "de"}},
+			"uk":      {Provider: "test", Country: "UK"},
+			"de":      {Provider: "test", Country: "DE"},
+		},
+	}
+
+	// Neither "fr" nor "uk" can be served
+	proxies := map[string]http.Handler{
+		"de": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+
+	handler := NewProxyHandler(
+		config.NewConfigExitResolver(cfg),
+		provider.NewStaticProvider(proxies),
+		PathIntentParser,
+	)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fr/http://example.com", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if got := w.Header().Get(HeaderExitUsed); got != "de" {
+		t.Errorf("expected %s 'de', got '%s'", HeaderExitUsed, got)
+	}
+}
+
+func TestNewProxyHandler_FallbackPolicy(t *testing.T) {
+	tests := []struct {
+		policy   string
+		wantCode int
+	}{
+		{policy: config.FallbackChain, wantCode: http.StatusBadGateway},
+		{policy: config.FallbackDefault, wantCode: http.StatusOK},
+		{policy: config.FallbackNone, wantCode: http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			cfg := &config.Config{
+				DefaultExit:    "default",
+				FallbackPolicy: tt.policy,
+				Exits: map[string]config.ExitConfig{
+					"default": {Provider: "test", Country: "US"},
+					"fr":      {Provider: "test", Country: "FR", Fallback: []string{"uk"}},
+					"uk":      {Provider: "test", Country: "UK"},
+				},
+			}
+
+			// Only the default exit can be served
+			proxies := map[string]http.Handler{
+				"default": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusOK)
+				}),
+			}
+
+			handler := NewProxyHandler(
+				config.NewConfigExitResolver(cfg),
+				provider.NewStaticProvider(proxies),
+				PathIntentParser,
+			)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fr/http://example.com", nil))
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected status %d, got %d", tt.wantCode, w.Code)
+			}
+		})
+	}
+}
+
+func TestNewProxyHandler_ForwardProxyRequest(t *testing.T) {
+	var gotReq *http.Request
+
+	cfg := &config.Config{
+		DefaultExit: "default",
+		Exits: map[string]config.ExitConfig{
+			"default": {Provider: "test", Country: "US"},
+			"kr":      {Provider: "test", Country: "KR"},
+		},
+	}
+
+	proxies := map[string]http.Handler{
+		"kr": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotReq = r
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+
+	handler := NewProxyHandler(
+		config.NewConfigExitResolver(cfg),
+		provider.NewStaticProvider(proxies),
+		HeaderExitParser("X-GeoSwitch-Exit"),
+		ProxyAuthExitParser,
+		AbsoluteFormParser,
+		PathIntentParser,
+	)
+
+	// As sent by a client with HTTP_PROXY=http://kr:x@geoswitch:8080
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/api?x=1", nil)
+	req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("kr:x")))
+	req.Header.Set("Proxy-Connection", "keep-alive")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if gotReq == nil {
+		t.Fatalf("expected proxy handler for exit 'kr' to be invoked")
+	}
+
+	if got := gotReq.URL.String(); got != "http://example.com/api?x=1" {
+		t.Errorf("expected URL 'http://example.com/api?x=1', got '%s'", got)
+	}
+
+	if gotReq.Host != "example.com" {
+		t.Errorf("expected request Host 'example.com', got '%s'", gotReq.Host)
+	}
+
+	for _, header := range []string{"Proxy-Authorization", "Proxy-Connection"} {
+		if got := gotReq.Header.Get(header); got != "" {
+			t.Errorf("expected %s to be stripped, got '%s'", header, got)
+		}
+	}
+}
+
+func TestNewProxyHandler_ConnectRequest(t *testing.T) {
+	var gotReq *http.Request
+
+	cfg := &config.Config{
+		DefaultExit: "default",
+		Exits: map[string]config.ExitConfig{
+			"default": {Provider: "test", Country: "US"},
+			"kr":      {Provider: "test", Country: "KR"},
+		},
+	}
+
+	proxies := map[string]http.Handler{
+		"kr": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotReq = r
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+
+	handler := NewProxyHandler(
+		config.NewConfigExitResolver(cfg),
+		provider.NewStaticProvider(proxies),
+		HeaderExitParser("X-GeoSwitch-Exit"),
+		ConnectParser,
+		AbsoluteFormParser,
+		PathIntentParser,
+	)
+
+	req := httptest.NewRequest(http.MethodConnect, "example.com:443", nil)
+	req.Header.Set("X-GeoSwitch-Exit", "kr")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if gotReq == nil {
+		t.Fatalf("expected proxy handler for exit 'kr' to be invoked")
+	}
+
+	if gotReq.Method != http.MethodConnect {
+		t.Errorf("expected method CONNECT, got '%s'", gotReq.Method)
+	}
+
+	if gotReq.Host != "example.com:443" {
+		t.Errorf("expected request Host 'example.com:443', got '%s'", gotReq.Host)
+	}
+
+	if got := w.Header().Get(HeaderExitUsed); got != "kr" {
+		t.Errorf("expected %s 'kr', got '%s'", HeaderExitUsed, got)
+	}
+}
+
+func TestNewProxyHandler_ConnectWithoutPort(t *testing.T) {
+	cfg := &config.Config{
+		DefaultExit: "default",
+		Exits: map[string]config.ExitConfig{
+			"default": {Provider: "test", Country: "US"},
+		},
+	}
+
+	proxies := map[string]http.Handler{
+		"default": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("expected proxy handler not to be invoked")
+		}),
+	}
+
+	handler := NewProxyHandler(
+		config.NewConfigExitResolver(cfg),
+		provider.NewStaticProvider(proxies),
+		ConnectParser,
+	)
+
+	req := httptest.NewRequest(http.MethodConnect, "example.com:443", nil)
+	req.Host = "example.com"
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestNewProxyHandler_StripsControlData(t *testing.T) {
+	var gotReq *http.Request
+
+	cfg := &config.Config{
+		DefaultExit: "default",
+		Exits: map[string]config.ExitConfig{
+			"default": {Provider: "test", Country: "US"},
+			"kr":      {Provider: "test", Country: "KR"},
+		},
+	}
+
+	proxies := map[string]http.Handler{
+		"kr": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotReq = r
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+
+	handler := NewProxyHandler(
+		config.NewConfigExitResolver(cfg),
+		provider.NewStaticProvider(proxies),
+		QueryExitParser("gs_exit"),
+		CookieExitParser("gs_exit"),
+		PathIntentParser,
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/http://example.com/api?gs_exit=kr&x=1", nil)
+	req.Header.Set("Cookie", "gs_exit=uk; id=7")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if gotReq.URL.RawQuery != "x=1" {
+		t.Errorf("expected query 'x=1', got '%s'", gotReq.URL.RawQuery)
+	}
+
+	if got := gotReq.Header.Get("Cookie"); got != "id=7" {
+		t.Errorf("expected cookie 'id=7', got '%s'", got)
+	}
+
+	if got := req.Header.Get("Cookie"); got != "gs_exit=uk; id=7" {
+		t.Errorf("expected original request to be unchanged, got cookie '%s'", got)
+	}
+}
@@ -1,9 +1,12 @@
 package handler
 
 import (
+	"encoding/base64"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 
 	"geoswitch/internal/types"
@@ -17,6 +20,29 @@ type RequestContext struct {
 	Exit   *types.Exit // nil if none explicitly requested
 
 	RemainingPath []string // unconsumed path segments
+
+	User    string // authenticated proxy user, empty if none
+	Session string // session requested by the client, empty if none
+
+	// Control query parameters and cookies taken from the request by parsers,
+	// which are not forwarded to the target
+	consumedParams  []string
+	consumedCookies []string
+}
+
+// rawQuery returns the query of the original request without the control
+// parameters consumed so far.
+func (ctx *RequestContext) rawQuery() string {
+	return stripQueryParams(ctx.Original.URL.RawQuery, ctx.consumedParams)
+}
+
+// consumeParam marks a query parameter as control data, removing it from a
+// target that was already parsed.
+func (ctx *RequestContext) consumeParam(name string) {
+	ctx.consumedParams = append(ctx.consumedParams, name)
+	if ctx.Target != nil {
+		ctx.Target.RawQuery = stripQueryParams(ctx.Target.RawQuery, []string{name})
+	}
 }
 
 type IntentParser func(*RequestContext) error
@@ -61,6 +87,222 @@ func HeaderExitParser(headerName string) IntentParser {
 	}
 }
 
+// QueryExitParser takes the exit from the query parameter paramName, e.g.
+// ?gs_exit=kr. The parameter is not forwarded to the target.
+func QueryExitParser(paramName string) IntentParser {
+	return func(ctx *RequestContext) error {
+		values, ok := ctx.Original.URL.Query()[paramName]
+		if !ok {
+			return nil
+		}
+		ctx.consumeParam(paramName)
+
+		val := strings.TrimSpace(values[0])
+		if ctx.Exit != nil || val == "" {
+			return nil
+		}
+
+		ctx.Exit = &types.Exit{Name: val}
+		log.Printf("[parser] query exit parser: found exit '%s' from query parameter '%s'", ctx.Exit.Name, paramName)
+		return nil
+	}
+}
+
+// CookieExitParser takes the exit from the cookie cookieName, so a browser
+// can stay on an exit across requests. The cookie is not forwarded to the target.
+func CookieExitParser(cookieName string) IntentParser {
+	return func(ctx *RequestContext) error {
+		cookie, err := ctx.Original.Cookie(cookieName)
+		if err != nil {
+			return nil
+		}
+		ctx.consumedCookies = append(ctx.consumedCookies, cookieName)
+
+		val := strings.TrimSpace(cookie.Value)
+		if ctx.Exit != nil || val == "" {
+			return nil
+		}
+
+		ctx.Exit = &types.Exit{Name: val}
+		log.Printf("[parser] cookie exit parser: found exit '%s' from cookie '%s'", ctx.Exit.Name, cookieName)
+		return nil
+	}
+}
+
+// QueryTargetParser takes the target from the query parameter paramName, which
+// must hold an absolute URL, e.g. ?gs_target=https%3A%2F%2Fexample.com%2F.
+// Other query parameters of the request are added to the target's own. The
+// parameter is not forwarded to the target.
+func QueryTargetParser(paramName string) IntentParser {
+	return func(ctx *RequestContext) error {
+		values, ok := ctx.Original.URL.Query()[paramName]
+		if !ok {
+			return nil
+		}
+		ctx.consumeParam(paramName)
+
+		if ctx.Target != nil {
+			return nil
+		}
+
+		target := parseAbsoluteURL(strings.TrimSpace(values[0]))
+		if target == nil {
+			log.Printf("[parser] query target parser: ignoring non-absolute target in query parameter '%s'", paramName)
+			return nil
+		}
+
+		if query := ctx.rawQuery(); query != "" {
+			if target.RawQuery != "" {
+				target.RawQuery += "&"
+			}
+			target.RawQuery += query
+		}
+		target.Fragment = ""
+
+		ctx.Target = target
+		log.Printf("[parser] query target parser: found target '%s' from query parameter '%s'", target.String(), paramName)
+		return nil
+	}
+}
+
+// HostIntentParser selects the exit, and optionally the target, from the
+// subdomain of baseDomain the request was sent to, so clients that can only
+// change the hostname can be pointed at an exit through wildcard DNS:
+//
+//	kr.geoswitch.local/https://example.com/  -> exit "kr", target from the path
+//	example-com.kr.geoswitch.local/page      -> exit "kr", target https://example.com/page
+//
+// In the target label, "-" stands for "." and "--" for a literal "-", so
+// "my--site-co-uk" is "my-site.co.uk". Requests to other hosts are left alone.
+func HostIntentParser(baseDomain string) IntentParser {
+	suffix := "." + strings.Trim(strings.ToLower(baseDomain), ".")
+
+	return func(ctx *RequestContext) error {
+		if ctx.Original.Method == http.MethodConnect {
+			return nil
+		}
+
+		host := strings.ToLower(ctx.Original.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		labels, ok := strings.CutSuffix(host, suffix)
+		if !ok || labels == "" {
+			return nil
+		}
+
+		var targetLabel, exitLabel string
+		switch parts := strings.Split(labels, "."); len(parts) {
+		case 1:
+			exitLabel = parts[0]
+		case 2:
+			targetLabel, exitLabel = parts[0], parts[1]
+		default:
+			log.Printf("[parser] host intent parser: ignoring host '%s' with too many labels", host)
+			return nil
+		}
+
+		if ctx.Exit == nil {
+			ctx.Exit = &types.Exit{Name: exitLabel}
+			log.Printf("[parser] host intent parser: found exit '%s' from host '%s'", exitLabel, host)
+		}
+
+		if targetLabel != "" && ctx.Target == nil {
+			ctx.Target = &url.URL{
+				Scheme:   "https",
+				Host:     decodeHostLabel(targetLabel),
+				Path:     ctx.Original.URL.Path,
+				RawQuery: ctx.rawQuery(),
+			}
+			ctx.RemainingPath = []string{}
+			log.Printf("[parser] host intent parser: found target '%s' from host '%s'", ctx.Target.String(), host)
+		}
+
+		return nil
+	}
+}
+
+// decodeHostLabel turns a label such as "my--site-com" back into the host "my-site.com".
+func decodeHostLabel(label string) string {
+	parts := strings.Split(label, "--")
+	for i, part := range parts {
+		parts[i] = strings.ReplaceAll(part, "-", ".")
+	}
+	return strings.Join(parts, "-")
+}
+
+// AbsoluteFormParser handles standard HTTP proxy requests, whose request
+// target is an absolute URL (GET http://example.com/ HTTP/1.1), so GeoSwitch
+// can be used as HTTP_PROXY. The whole URL is the target and no path segments
+// are left for other parsers.
+func AbsoluteFormParser(ctx *RequestContext) error {
+	if ctx.Target != nil || !ctx.Original.URL.IsAbs() {
+		return nil
+	}
+
+	target := *ctx.Original.URL
+	target.RawQuery = ctx.rawQuery()
+	target.Fragment = ""
+	ctx.Target = &target
+	ctx.RemainingPath = []string{}
+
+	log.Printf("[parser] absolute-form parser: found target '%s' from request line", target.String())
+	return nil
+}
+
+// ConnectParser handles CONNECT requests, whose request target is the
+// host:port to open a tunnel to (CONNECT example.com:443 HTTP/1.1). The
+// target is returned without a scheme.
+func ConnectParser(ctx *RequestContext) error {
+	if ctx.Target != nil || ctx.Original.Method != http.MethodConnect {
+		return nil
+	}
+
+	ctx.Target = &url.URL{Host: ctx.Original.Host}
+	ctx.RemainingPath = []string{}
+
+	log.Printf("[parser] connect parser: found tunnel target '%s'", ctx.Target.Host)
+	return nil
+}
+
+// ProxyAuthExitParser takes the exit from the username of a Basic
+// Proxy-Authorization header, e.g. http://kr:x@geoswitch:8080 as HTTP_PROXY.
+// The password is ignored. Usernames already authenticated by
+// ProxyUserParser are left alone.
+func ProxyAuthExitParser(ctx *RequestContext) error {
+	if ctx.Exit != nil || ctx.User != "" {
+		return nil
+	}
+
+	username, _, ok := proxyBasicAuth(ctx.Original)
+	username = strings.TrimSpace(username)
+	if !ok || username == "" {
+		return nil
+	}
+
+	ctx.Exit = &types.Exit{Name: username}
+	log.Printf("[parser] proxy auth exit parser: found exit '%s' from Proxy-Authorization", ctx.Exit.Name)
+	return nil
+}
+
+// proxyBasicAuth returns the credentials of a Basic Proxy-Authorization header.
+func proxyBasicAuth(r *http.Request) (username, password string, ok bool) {
+	const prefix = "Basic "
+
+	auth := r.Header.Get("Proxy-Authorization")
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(auth[len(prefix):])
+	if err != nil {
+		return "", "", false
+	}
+
+	return strings.Cut(string(decoded), ":")
+}
+
 func ParseRequestIntent(r *http.Request, parsers ...IntentParser) (*RequestContext, error) {
 	ctx := &RequestContext{
 		Original:      r,
@@ -107,8 +349,8 @@ func findTargetURLInPath(ctx *RequestContext) (*url.URL, []string) {
 	for i := 0; i < len(ctx.RemainingPath); i++ {
 		candidate := strings.Join(ctx.RemainingPath[i:], "/")
 
-		if ctx.Original.URL.RawQuery != "" {
-			candidate += "?" + ctx.Original.URL.RawQuery
+		if query := ctx.rawQuery(); query != "" {
+			candidate += "?" + query
 		}
 
 		if u := parseAbsoluteURL(candidate); u != nil {
@@ -167,3 +409,50 @@ func logParsedIntent(ctx *RequestContext) {
 		ctx.RemainingPath,
 	)
 }
+
+// stripQueryParams removes the parameters named in names from a raw query,
+// leaving the encoding and order of the others untouched.
+func stripQueryParams(rawQuery string, names []string) string {
+	if rawQuery == "" || len(names) == 0 {
+		return rawQuery
+	}
+
+	var kept []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		key, _, _ := strings.Cut(pair, "=")
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if !slices.Contains(names, key) {
+			kept = append(kept, pair)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+// stripCookies removes the cookies named in names from the Cookie headers of h,
+// dropping headers that end up empty.
+func stripCookies(h http.Header, names []string) {
+	if len(names) == 0 {
+		return
+	}
+
+	var lines []string
+	for _, line := range h.Values("Cookie") {
+		var kept []string
+		for _, part := range strings.Split(line, ";") {
+			name, _, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if !slices.Contains(names, name) {
+				kept = append(kept, strings.TrimSpace(part))
+			}
+		}
+		if len(kept) > 0 {
+			lines = append(lines, strings.Join(kept, "; "))
+		}
+	}
+
+	h.Del("Cookie")
+	for _, line := range lines {
+		h.Add("Cookie", line)
+	}
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"encoding/base64"
 	"net/http/httptest"
 	"net/url"
 	"strings"
@@ -417,3 +418,309 @@ func TestHeaderExitParser_MissingHeader(t *testing.T) {
 		t.Errorf("expected no exit to be set when header is missing, got %v", ctx.Exit)
 	}
 }
+
+func TestAbsoluteFormParser_SetsTargetFromRequestLine(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://example.com/path?x=1", nil)
+
+	ctx := &RequestContext{
+		Original:      req,
+		RemainingPath: SplitPath(req.URL.Path),
+	}
+
+	if err := AbsoluteFormParser(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ctx.Target == nil {
+		t.Fatalf("expected target to be set")
+	}
+
+	if got := ctx.Target.String(); got != "http://example.com/path?x=1" {
+		t.Errorf("expected target 'http://example.com/path?x=1', got '%s'", got)
+	}
+
+	if len(ctx.RemainingPath) != 0 {
+		t.Errorf("expected no remaining path segments, got %v", ctx.RemainingPath)
+	}
+
+	// The parsed target must not alias the original request URL
+	ctx.Target.Host = "changed"
+	if req.URL.Host != "example.com" {
+		t.Errorf("expected original request URL to be unchanged, got host '%s'", req.URL.Host)
+	}
+}
+
+func TestAbsoluteFormParser_IgnoresOriginForm(t *testing.T) {
+	req := httptest.NewRequest("GET", "/kr/http://example.com", nil)
+
+	ctx := &RequestContext{
+		Original:      req,
+		RemainingPath: SplitPath(req.URL.Path),
+	}
+
+	if err := AbsoluteFormParser(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ctx.Target != nil {
+		t.Errorf("expected no target, got '%s'", ctx.Target.String())
+	}
+
+	if want := SplitPath(req.URL.Path); len(ctx.RemainingPath) != len(want) {
+		t.Errorf("expected path segments %v to be left for other parsers, got %v", want, ctx.RemainingPath)
+	}
+}
+
+func TestProxyAuthExitParser(t *testing.T) {
+	cases := []struct {
+		name   string
+		header string
+		want   string // empty for no exit
+	}{
+		{"username", "Basic " + base64.StdEncoding.EncodeToString([]byte("kr:secret")), "kr"},
+		{"noPassword", "Basic " + base64.StdEncoding.EncodeToString([]byte("kr")), ""},
+		{"emptyUsername", "Basic " + base64.StdEncoding.EncodeToString([]byte(":secret")), ""},
+		{"lowercaseScheme", "basic " + base64.StdEncoding.EncodeToString([]byte("uk:x")), "uk"},
+		{"bearer", "Bearer token", ""},
+		{"invalidBase64", "Basic !!!", ""},
+		{"missing", "", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/", nil)
+			if tc.header != "" {
+				req.Header.Set("Proxy-Authorization", tc.header)
+			}
+
+			ctx := &RequestContext{Original: req}
+			if err := ProxyAuthExitParser(ctx); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			switch {
+			case tc.want == "" && ctx.Exit != nil:
+				t.Errorf("expected no exit, got '%s'", ctx.Exit.Name)
+			case tc.want != "" && ctx.Exit == nil:
+				t.Errorf("expected exit '%s', got none", tc.want)
+			case tc.want != "" && ctx.Exit.Name != tc.want:
+				t.Errorf("expected exit '%s', got '%s'", tc.want, ctx.Exit.Name)
+			}
+		})
+	}
+}
+
+func TestProxyAuthExitParser_DoesNotOverrideExistingExit(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("kr:x")))
+
+	ctx := &RequestContext{
+		Original: req,
+		Exit:     &types.Exit{Name: "header-exit"},
+	}
+
+	if err := ProxyAuthExitParser(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ctx.Exit.Name != "header-exit" {
+		t.Errorf("expected exit 'header-exit', got '%s'", ctx.Exit.Name)
+	}
+}
+
+func TestHostIntentParser(t *testing.T) {
+	cases := []struct {
+		name   string
+		host   string
+		path   string
+		exit   string // empty for no exit
+		target string // empty for no target
+	}{
+		{"exitOnly", "kr.geoswitch.local", "/https://example.com/", "kr", ""},
+		{"exitWithPort", "kr.geoswitch.local:8080", "/", "kr", ""},
+		{"uppercase", "KR.GeoSwitch.Local", "/", "kr", ""},
+		{"targetAndExit", "example-com.kr.geoswitch.local", "/page?x=1", "kr", "https://example.com/page?x=1"},
+		{"literalDash", "my--site-co-uk.uk.geoswitch.local", "/", "uk", "https://my-site.co.uk/"},
+		{"otherDomain", "kr.example.com", "/", "", ""},
+		{"baseDomain", "geoswitch.local", "/", "", ""},
+		{"tooManyLabels", "a.b.kr.geoswitch.local", "/", "", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.path, nil)
+			req.Host = tc.host
+
+			ctx := &RequestContext{
+				Original:      req,
+				RemainingPath: SplitPath(req.URL.Path),
+			}
+
+			if err := HostIntentParser("geoswitch.local")(ctx); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			switch {
+			case tc.exit == "" && ctx.Exit != nil:
+				t.Errorf("expected no exit, got '%s'", ctx.Exit.Name)
+			case tc.exit != "" && ctx.Exit == nil:
+				t.Errorf("expected exit '%s', got none", tc.exit)
+			case tc.exit != "" && ctx.Exit.Name != tc.exit:
+				t.Errorf("expected exit '%s', got '%s'", tc.exit, ctx.Exit.Name)
+			}
+
+			switch {
+			case tc.target == "" && ctx.Target != nil:
+				t.Errorf("expected no target, got '%s'", ctx.Target.String())
+			case tc.target != "" && ctx.Target == nil:
+				t.Errorf("expected target '%s', got none", tc.target)
+			case tc.target != "" && ctx.Target.String() != tc.target:
+				t.Errorf("expected target '%s', got '%s'", tc.target, ctx.Target.String())
+			}
+		})
+	}
+}
+
+func TestParseRequestIntent_HostExitThenPathTarget(t *testing.T) {
+	req := httptest.NewRequest("GET", "/https://example.com/api", nil)
+	req.Host = "kr.geoswitch.local"
+
+	ctx, err := ParseRequestIntent(req, HostIntentParser("geoswitch.local"), PathIntentParser)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ctx.Exit == nil || ctx.Exit.Name != "kr" {
+		t.Fatalf("expected exit 'kr', got %v", ctx.Exit)
+	}
+
+	if ctx.Target == nil || ctx.Target.String() != "https://example.com/api" {
+		t.Errorf("expected target 'https://example.com/api', got %v", ctx.Target)
+	}
+}
+
+func TestQueryExitParser_StripsParamFromPathTarget(t *testing.T) {
+	orders := map[string][]IntentParser{
+		"queryFirst": {QueryExitParser("gs_exit"), PathIntentParser},
+		"pathFirst":  {PathIntentParser, QueryExitParser("gs_exit")},
+	}
+
+	for name, parsers := range orders {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/https://example.com/api?x=1&gs_exit=kr&y=2", nil)
+
+			ctx, err := ParseRequestIntent(req, parsers...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if ctx.Exit == nil || ctx.Exit.Name != "kr" {
+				t.Fatalf("expected exit 'kr', got %v", ctx.Exit)
+			}
+
+			if got := ctx.Target.String(); got != "https://example.com/api?x=1&y=2" {
+				t.Errorf("expected target 'https://example.com/api?x=1&y=2', got '%s'", got)
+			}
+		})
+	}
+}
+
+func TestQueryExitParser_DoesNotOverrideExistingExit(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?gs_exit=kr", nil)
+
+	ctx := &RequestContext{
+		Original: req,
+		Exit:     &types.Exit{Name: "header-exit"},
+	}
+
+	if err := QueryExitParser("gs_exit")(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ctx.Exit.Name != "header-exit" {
+		t.Errorf("expected exit 'header-exit', got '%s'", ctx.Exit.Name)
+	}
+
+	if got := ctx.rawQuery(); got != "" {
+		t.Errorf("expected control parameter to be consumed anyway, got query '%s'", got)
+	}
+}
+
+func TestCookieExitParser(t *testing.T) {
+	req := httptest.NewRequest("GET", "/https://example.com/", nil)
+	req.Header.Set("Cookie", "session=abc; gs_exit=uk; theme=dark")
+
+	ctx, err := ParseRequestIntent(req, CookieExitParser("gs_exit"), PathIntentParser)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ctx.Exit == nil || ctx.Exit.Name != "uk" {
+		t.Fatalf("expected exit 'uk', got %v", ctx.Exit)
+	}
+
+	forwarded := req.Header.Clone()
+	stripCookies(forwarded, ctx.consumedCookies)
+
+	if got := forwarded.Get("Cookie"); got != "session=abc; theme=dark" {
+		t.Errorf("expected cookie 'gs_exit' to be stripped, got '%s'", got)
+	}
+}
+
+func TestQueryTargetParser(t *testing.T) {
+	target := url.QueryEscape("https://example.com/search?q=go")
+	req := httptest.NewRequest("GET", "/?gs_target="+target+"&page=2&gs_exit=kr", nil)
+
+	ctx, err := ParseRequestIntent(req, QueryExitParser("gs_exit"), QueryTargetParser("gs_target"), PathIntentParser)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ctx.Exit == nil || ctx.Exit.Name != "kr" {
+		t.Fatalf("expected exit 'kr', got %v", ctx.Exit)
+	}
+
+	if ctx.Target == nil {
+		t.Fatalf("expected target to be set")
+	}
+
+	if got := ctx.Target.String(); got != "https://example.com/search?q=go&page=2" {
+		t.Errorf("expected target 'https://example.com/search?q=go&page=2', got '%s'", got)
+	}
+}
+
+func TestQueryTargetParser_IgnoresRelativeTarget(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?gs_target=/local", nil)
+
+	ctx := &RequestContext{Original: req}
+	if err := QueryTargetParser("gs_target")(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ctx.Target != nil {
+		t.Errorf("expected no target, got '%s'", ctx.Target.String())
+	}
+}
+
+func TestStripQueryParams(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{"empty", "", ""},
+		{"only control", "gs_exit=kr", ""},
+		{"keepsOthers", "a=1&gs_exit=kr&b=2", "a=1&b=2"},
+		{"encodedName", "gs%5Fexit=kr&a=1", "a=1"},
+		{"keepsEncoding", "q=a%20b&gs_exit=kr", "q=a%20b"},
+		{"noValue", "gs_exit&a=1", "a=1"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := stripQueryParams(tc.in, []string{"gs_exit"}); got != tc.out {
+				t.Errorf("expected '%s', got '%s'", tc.out, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"cmp"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"geoswitch/internal/config"
+	"geoswitch/internal/types"
+)
+
+// ErrProxyAuth is returned by parsers when proxy credentials are required but
+// missing, or present but invalid. The handler answers it with 407.
+var ErrProxyAuth = errors.New("proxy authentication required")
+
+// ProxyUserParser authenticates the Basic Proxy-Authorization credentials of
+// a request against the proxy_auth users of the current config, and takes the
+// exit and session flags from the username. With the default pattern
+// "<user>-exit-<exit>", the username "alice-exit-kr-session-42" authenticates
+// as alice and selects exit "kr" with session "42". A bare "alice" only
+// authenticates.
+//
+// The parser does nothing while no users are configured. Credentials are
+// checked even when an earlier parser already chose the exit.
+func ProxyUserParser(resolver *config.ConfigExitResolver) IntentParser {
+	var patterns usernamePatterns
+
+	return func(ctx *RequestContext) error {
+		auth := resolver.Config().ProxyAuth
+		if len(auth.Users) == 0 {
+			return nil
+		}
+
+		username, password, ok := proxyBasicAuth(ctx.Original)
+		if !ok {
+			if auth.Required {
+				log.Printf("[parser] proxy user parser: no credentials from %s", ctx.Original.RemoteAddr)
+				return ErrProxyAuth
+			}
+			return nil
+		}
+
+		u := patterns.parse(cmp.Or(auth.Pattern, config.DefaultProxyAuthPattern), username)
+
+		want, ok := auth.Users[u.user]
+		if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(want)) != 1 {
+			log.Printf("[parser] proxy user parser: invalid credentials for user '%s' from %s", u.user, ctx.Original.RemoteAddr)
+			return ErrProxyAuth
+		}
+
+		ctx.User = u.user
+		if ctx.Session == "" {
+			ctx.Session = u.session
+		}
+		if ctx.Exit == nil && u.exit != "" {
+			ctx.Exit = &types.Exit{Name: u.exit}
+			log.Printf("[parser] proxy user parser: found exit '%s' for user '%s'", u.exit, u.user)
+		}
+		return nil
+	}
+}
+
+// proxyUsername is a username split according to the proxy_auth pattern.
+type proxyUsername struct {
+	user    string
+	exit    string // empty if the username names no exit
+	session string // empty if no session flag was given
+}
+
+// usernamePatterns caches the compiled form of the last username pattern, which
+// only changes on config reloads.
+type usernamePatterns struct {
+	mu      sync.Mutex
+	pattern string
+	re      *regexp.Regexp
+}
+
+// parse splits username according to pattern. Usernames that do not match the
+// pattern are taken as a bare user.
+func (p *usernamePatterns) parse(pattern, username string) proxyUsername {
+	re := p.compile(pattern)
+	m := re.FindStringSubmatch(username)
+	if m == nil {
+		return proxyUsername{user: username}
+	}
+
+	u := proxyUsername{
+		user: m[re.SubexpIndex("user")],
+		exit: strings.ToLower(m[re.SubexpIndex("exit")]),
+	}
+
+	// Flags follow the pattern as "-<flag>-<value>" pairs
+	flags := strings.Split(strings.TrimPrefix(m[re.SubexpIndex("flags")], "-"), "-")
+	for i := 0; i+1 < len(flags); i += 2 {
+		if flags[i] == "session" {
+			u.session = flags[i+1]
+		}
+	}
+	return u
+}
+
+func (p *usernamePatterns) compile(pattern string) *regexp.Regexp {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.re != nil && p.pattern == pattern {
+		return p.re
+	}
+
+	// Validation guarantees each placeholder appears exactly once
+	var expr strings.Builder
+	expr.WriteString("^")
+	rest := pattern
+	for rest != "" {
+		i := strings.Index(rest, "<")
+		if i < 0 {
+			expr.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+		expr.WriteString(regexp.QuoteMeta(rest[:i]))
+		rest = rest[i:]
+
+		switch {
+		case strings.HasPrefix(rest, "<user>"):
+			expr.WriteString("(?P<user>.+?)")
+			rest = rest[len("<user>"):]
+		case strings.HasPrefix(rest, "<exit>"):
+			expr.WriteString("(?P<exit>.+?)")
+			rest = rest[len("<exit>"):]
+		default:
+			expr.WriteString(regexp.QuoteMeta("<"))
+			rest = rest[1:]
+		}
+	}
+	expr.WriteString("(?P<flags>(?:-session-[^-]+)*)$")
+
+	p.pattern = pattern
+	p.re = regexp.MustCompile(expr.String())
+	return p.re
+}
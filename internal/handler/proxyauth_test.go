@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"geoswitch/internal/config"
+	"geoswitch/internal/provider"
+	"geoswitch/internal/types"
+)
+
+func newProxyAuthResolver(auth config.ProxyAuthConfig) *config.ConfigExitResolver {
+	return config.NewConfigExitResolver(&config.Config{
+		DefaultExit: "default",
+		Exits: map[string]config.ExitConfig{
+			"default": {Provider: "test", Country: "US"},
+			"kr":      {Provider: "test", Country: "KR"},
+		},
+		ProxyAuth: auth,
+	})
+}
+
+func withProxyAuth(req *http.Request, username, password string) *http.Request {
+	credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	return req
+}
+
+func TestProxyUserParser(t *testing.T) {
+	users := map[string]string{"alice": "s3cret", "bob-smith": "hunter2"}
+
+	tests := []struct {
+		name     string
+		pattern  string
+		username string
+		password string
+
+		wantErr     bool
+		wantUser    string
+		wantExit    string // empty for no exit
+		wantSession string
+	}{
+		{name: "exit", username: "alice-exit-kr", password: "s3cret", wantUser: "alice", wantExit: "kr"},
+		{name: "exit and session", username: "alice-exit-kr-session-42", password: "s3cret", wantUser: "alice", wantExit: "kr", wantSession: "42"},
+		{name: "hyphenated exit", username: "alice-exit-us-east", password: "s3cret", wantUser: "alice", wantExit: "us-east"},
+		{name: "hyphenated user", username: "bob-smith-exit-kr", password: "hunter2", wantUser: "bob-smith", wantExit: "kr"},
+		{name: "bare user", username: "alice", password: "s3cret", wantUser: "alice"},
+		{name: "custom pattern", pattern: "<exit>.<user>", username: "kr.alice-session-7", password: "s3cret", wantUser: "alice", wantExit: "kr", wantSession: "7"},
+		{name: "wrong password", username: "alice-exit-kr", password: "wrong", wantErr: true},
+		{name: "unknown user", username: "mallory-exit-kr", password: "s3cret", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parse := ProxyUserParser(newProxyAuthResolver(config.ProxyAuthConfig{Pattern: tt.pattern, Users: users}))
+
+			req := withProxyAuth(httptest.NewRequest(http.MethodGet, "http://example.com/", nil), tt.username, tt.password)
+			ctx := &RequestContext{Original: req}
+
+			err := parse(ctx)
+			if tt.wantErr {
+				if !errors.Is(err, ErrProxyAuth) {
+					t.Fatalf("expected ErrProxyAuth, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if ctx.User != tt.wantUser {
+				t.Errorf("expected user '%s', got '%s'", tt.wantUser, ctx.User)
+			}
+
+			switch {
+			case tt.wantExit == "" && ctx.Exit != nil:
+				t.Errorf("expected no exit, got '%s'", ctx.Exit.Name)
+			case tt.wantExit != "" && ctx.Exit == nil:
+				t.Errorf("expected exit '%s', got none", tt.wantExit)
+			case tt.wantExit != "" && ctx.Exit.Name != tt.wantExit:
+				t.Errorf("expected exit '%s', got '%s'", tt.wantExit, ctx.Exit.Name)
+			}
+
+			if ctx.Session != tt.wantSession {
+				t.Errorf("expected session '%s', got '%s'", tt.wantSession, ctx.Session)
+			}
+		})
+	}
+}
+
+func TestProxyUserParser_ChecksCredentialsWhenExitIsSet(t *testing.T) {
+	parse := ProxyUserParser(newProxyAuthResolver(config.ProxyAuthConfig{Users: map[string]string{"alice": "s3cret"}}))
+
+	req := withProxyAuth(httptest.NewRequest(http.MethodGet, "http://example.com/", nil), "alice", "wrong")
+	ctx := &RequestContext{Original: req, Exit: &types.Exit{Name: "kr"}}
+
+	if err := parse(ctx); !errors.Is(err, ErrProxyAuth) {
+		t.Fatalf("expected ErrProxyAuth, got %v", err)
+	}
+}
+
+func TestProxyUserParser_Required(t *testing.T) {
+	tests := []struct {
+		required bool
+		wantErr  bool
+	}{
+		{required: false, wantErr: false},
+		{required: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		parse := ProxyUserParser(newProxyAuthResolver(config.ProxyAuthConfig{
+			Users:    map[string]string{"alice": "s3cret"},
+			Required: tt.required,
+		}))
+
+		ctx := &RequestContext{Original: httptest.NewRequest(http.MethodGet, "http://example.com/", nil)}
+		if err := parse(ctx); errors.Is(err, ErrProxyAuth) != tt.wantErr {
+			t.Errorf("required=%t: expected ErrProxyAuth=%t, got %v", tt.required, tt.wantErr, err)
+		}
+	}
+}
+
+func TestProxyUserParser_DisabledWithoutUsers(t *testing.T) {
+	parse := ProxyUserParser(newProxyAuthResolver(config.ProxyAuthConfig{}))
+
+	req := withProxyAuth(httptest.NewRequest(http.MethodGet, "http://example.com/", nil), "kr", "anything")
+	ctx := &RequestContext{Original: req}
+
+	if err := parse(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ctx.User != "" || ctx.Exit != nil {
+		t.Errorf("expected request to be left alone, got user '%s' and exit %v", ctx.User, ctx.Exit)
+	}
+}
+
+func TestNewProxyHandler_ProxyAuthFailureReturns407(t *testing.T) {
+	resolver := newProxyAuthResolver(config.ProxyAuthConfig{Users: map[string]string{"alice": "s3cret"}})
+
+	handler := NewProxyHandler(
+		resolver,
+		provider.NewStaticProvider(map[string]http.Handler{}),
+		ProxyUserParser(resolver),
+		ProxyAuthExitParser,
+		AbsoluteFormParser,
+	)
+
+	req := withProxyAuth(httptest.NewRequest(http.MethodGet, "http://example.com/", nil), "alice-exit-kr", "wrong")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusProxyAuthRequired {
+		t.Fatalf("expected status %d, got %d", http.StatusProxyAuthRequired, w.Code)
+	}
+
+	if got := w.Header().Get("Proxy-Authenticate"); got == "" {
+		t.Error("expected a Proxy-Authenticate challenge")
+	}
+}
@@ -0,0 +1,82 @@
+package provider
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"geoswitch/internal/config"
+)
+
+type cachedExit struct {
+	cfg       config.ExitConfig
+	handler   http.Handler
+	transport *http.Transport
+	created   time.Time
+}
+
+// exitCache holds the handlers of providers that need no lifecycle beyond an
+// http.Transport. A handler is rebuilt when its exit's configuration changes.
+type exitCache struct {
+	mu    sync.Mutex
+	exits map[string]*cachedExit
+}
+
+// buildFunc creates the handler for an exit together with the transport backing it.
+type buildFunc func() (http.Handler, *http.Transport, error)
+
+// get returns the cached handler for exitName if it was built from cfg,
+// otherwise it builds, caches and returns a new one.
+func (c *exitCache) get(exitName string, cfg config.ExitConfig, build buildFunc) (http.Handler, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.exits == nil {
+		c.exits = make(map[string]*cachedExit)
+	}
+
+	if exit, ok := c.exits[exitName]; ok && reflect.DeepEqual(exit.cfg, cfg) {
+		return exit.handler, nil
+	}
+
+	handler, transport, err := build()
+	if err != nil {
+		return nil, err
+	}
+
+	if old, ok := c.exits[exitName]; ok {
+		old.transport.CloseIdleConnections()
+	}
+	c.exits[exitName] = &cachedExit{
+		cfg:       cfg,
+		handler:   handler,
+		transport: transport,
+		created:   time.Now(),
+	}
+
+	return handler, nil
+}
+
+// remove drops the cached handler for exitName and closes its idle connections.
+func (c *exitCache) remove(exitName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if exit, ok := c.exits[exitName]; ok {
+		exit.transport.CloseIdleConnections()
+		delete(c.exits, exitName)
+	}
+}
+
+// status reports whether a handler is cached for exitName.
+func (c *exitCache) status(exitName string) ExitStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	exit, ok := c.exits[exitName]
+	if !ok {
+		return ExitStatus{State: StateStopped}
+	}
+	return ExitStatus{State: StateRunning, CreatedAt: exit.created}
+}
@@ -0,0 +1,127 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"geoswitch/internal/config"
+	"geoswitch/internal/proxy"
+)
+
+// DirectProvider serves exits that egress straight from the host, without a
+// tunnel or upstream proxy. Outgoing connections can optionally be bound to a
+// source IP or network interface per exit.
+type DirectProvider struct {
+	cache exitCache
+}
+
+func (p *DirectProvider) GetHandler(
+	_ context.Context,
+	exitName string,
+	cfg config.ExitConfig,
+) (http.Handler, error) {
+	return p.cache.get(exitName, cfg, func() (http.Handler, *http.Transport, error) {
+		localAddr, err := directLocalAddr(cfg)
+		if err != nil {
+			log.Printf("[direct] invalid bind settings for exit '%s': %v", exitName, err)
+			return nil, nil, err
+		}
+
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			LocalAddr: localAddr,
+		}
+
+		if localAddr != nil {
+			log.Printf("[direct] creating handler for exit '%s' bound to %s", exitName, localAddr)
+		} else {
+			log.Printf("[direct] creating handler for exit '%s'", exitName)
+		}
+
+		transport := newTransport(dialer.DialContext)
+		handler := proxy.NewConnectHandler(proxy.NewReverseProxy(proxy.WithTransport(transport)), dialer.DialContext)
+		return handler, transport, nil
+	})
+}
+
+func (p *DirectProvider) ExitStatus(_ context.Context, exitName string, _ config.ExitConfig) (ExitStatus, bool) {
+	return p.cache.status(exitName), true
+}
+
+// StopExit drops the cached handler for exitName and closes its idle connections.
+func (p *DirectProvider) StopExit(_ context.Context, exitName string) error {
+	p.cache.remove(exitName)
+	return nil
+}
+
+func NewDirectProvider() *DirectProvider {
+	log.Printf("[direct] initializing DirectProvider")
+	return &DirectProvider{}
+}
+
+// newTransport returns an http.Transport tuned for proxying, dialling with dial
+// and not honouring any proxy environment variables.
+func newTransport(dial func(ctx context.Context, network, addr string) (net.Conn, error)) *http.Transport {
+	return &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dial,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// directLocalAddr returns the local address outgoing connections should be bound
+// to, derived from the exit's source_ip or interface. It returns nil when neither is set.
+func directLocalAddr(cfg config.ExitConfig) (net.Addr, error) {
+	if cfg.SourceIP != "" {
+		ip := net.ParseIP(cfg.SourceIP)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid source IP '%s'", cfg.SourceIP)
+		}
+		return &net.TCPAddr{IP: ip}, nil
+	}
+
+	if cfg.Interface == "" {
+		return nil, nil
+	}
+
+	iface, err := net.InterfaceByName(cfg.Interface)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find interface '%s': %w", cfg.Interface, err)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list addresses of interface '%s': %w", cfg.Interface, err)
+	}
+
+	// Prefer IPv4, as most exits are reached over IPv4
+	var fallback net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return &net.TCPAddr{IP: ipNet.IP}, nil
+		}
+		if fallback == nil {
+			fallback = ipNet.IP
+		}
+	}
+
+	if fallback != nil {
+		return &net.TCPAddr{IP: fallback}, nil
+	}
+
+	return nil, fmt.Errorf("interface '%s' has no IP addresses", cfg.Interface)
+}
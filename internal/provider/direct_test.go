@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"geoswitch/internal/config"
+)
+
+func TestDirectProvider_ProxiesFromHost(t *testing.T) {
+	var remoteAddr string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddr = r.RemoteAddr
+		_, _ = w.Write([]byte("direct"))
+	}))
+	defer target.Close()
+
+	p := NewDirectProvider()
+
+	h, err := p.GetHandler(context.Background(), "home", config.ExitConfig{
+		Provider: "direct",
+		Country:  "US",
+		SourceIP: "127.0.0.1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	targetURL, _ := url.Parse(target.URL)
+	req := httptest.NewRequest(http.MethodGet, target.URL, nil)
+	req.Host = targetURL.Host
+	req.RequestURI = ""
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if body := w.Body.String(); body != "direct" {
+		t.Errorf("expected body 'direct', got '%s'", body)
+	}
+
+	host, _, _ := net.SplitHostPort(remoteAddr)
+	if host != "127.0.0.1" {
+		t.Errorf("expected connection from 127.0.0.1, got '%s'", host)
+	}
+}
+
+func TestDirectProvider_ReusesHandlerForSameConfig(t *testing.T) {
+	p := NewDirectProvider()
+	cfg := config.ExitConfig{Provider: "direct", Country: "US"}
+
+	first, err := p.GetHandler(context.Background(), "home", cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	second, err := p.GetHandler(context.Background(), "home", cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if first != second {
+		t.Error("expected cached handler to be reused")
+	}
+}
+
+func TestDirectProvider_UnknownInterface(t *testing.T) {
+	p := NewDirectProvider()
+
+	_, err := p.GetHandler(context.Background(), "home", config.ExitConfig{
+		Provider:  "direct",
+		Country:   "US",
+		Interface: "does-not-exist0",
+	})
+	if err == nil {
+		t.Fatal("expected error for unknown interface, got nil")
+	}
+}
+
+func TestDirectProvider_TunnelsConnect(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("tunnelled"))
+	}))
+	defer target.Close()
+
+	p := NewDirectProvider()
+
+	h, err := p.GetHandler(context.Background(), "home", config.ExitConfig{Provider: "direct", Country: "US"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	geoswitch := httptest.NewServer(h)
+	defer geoswitch.Close()
+
+	// An https request through the exit goes over a CONNECT tunnel
+	proxyURL, _ := url.Parse(geoswitch.URL)
+	transport := target.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+
+	resp, err := (&http.Client{Transport: transport}).Get(target.URL)
+	if err != nil {
+		t.Fatalf("request through tunnel failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "tunnelled" {
+		t.Errorf("expected body 'tunnelled', got '%s'", body)
+	}
+}
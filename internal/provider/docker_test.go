@@ -0,0 +1,438 @@
+package provider
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+)
+
+// fakeContainer is a container known to fakeDocker.
+type fakeContainer struct {
+	ID     string
+	Name   string
+	Env    []string
+	Labels map[string]string
+	Status string            // "created", "running" or "exited"
+	Health string            // "" for no healthcheck, otherwise "starting", "healthy" or "unhealthy"
+	Files  map[string]string // regular files copied into the container, by absolute path
+}
+
+// fakeDocker is a minimal in-process Docker Engine API covering the calls
+// GluetunProvider makes. Containers become healthy as soon as they start
+// unless startHealth says otherwise.
+type fakeDocker struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu          sync.Mutex
+	containers  map[string]*fakeContainer // by ID
+	nextID      int
+	creates     int
+	inspects    int
+	startHealth string
+
+	// gates block creation of the named containers until released
+	gates map[string]chan struct{}
+	// events is streamed to clients following /events
+	events chan events.Message
+	// createStarted receives the container name of each creation as it begins
+	createStarted chan string
+}
+
+func newFakeDocker(t *testing.T) *fakeDocker {
+	t.Helper()
+
+	d := &fakeDocker{
+		t:             t,
+		containers:    make(map[string]*fakeContainer),
+		gates:         make(map[string]chan struct{}),
+		startHealth:   "healthy",
+		createStarted: make(chan string, 64),
+		events:        make(chan events.Message, 64),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{version}/networks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		writeDockerJSON(w, http.StatusOK, map[string]any{"Name": r.PathValue("id"), "Id": "net-1"})
+	})
+	mux.HandleFunc("GET /{version}/images/{name...}", func(w http.ResponseWriter, r *http.Request) {
+		writeDockerJSON(w, http.StatusOK, map[string]any{"Id": "sha256:image"})
+	})
+	mux.HandleFunc("GET /{version}/containers/json", d.handleList)
+	mux.HandleFunc("POST /{version}/containers/create", d.handleCreate)
+	mux.HandleFunc("DELETE /{version}/containers/{id}", d.handleRemove)
+	mux.HandleFunc("GET /{version}/containers/{id}/json", d.handleInspect)
+	mux.HandleFunc("POST /{version}/containers/{id}/start", d.handleStart)
+	mux.HandleFunc("PUT /{version}/containers/{id}/archive", d.handleArchive)
+	mux.HandleFunc("POST /{version}/containers/{id}/stop", d.handleStop)
+	mux.HandleFunc("POST /{version}/containers/{id}/wait", func(w http.ResponseWriter, r *http.Request) {
+		writeDockerJSON(w, http.StatusOK, map[string]any{"StatusCode": 0})
+	})
+	mux.HandleFunc("GET /{version}/events", d.handleEvents)
+	mux.HandleFunc("GET /{version}/containers/{id}/logs", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	d.server = httptest.NewServer(mux)
+	t.Cleanup(d.server.Close)
+	return d
+}
+
+// client returns a Docker client talking to the fake server.
+func (d *fakeDocker) client() *client.Client {
+	d.t.Helper()
+
+	cli, err := client.NewClientWithOpts(
+		client.WithHost("tcp://" + d.server.Listener.Addr().String()),
+	)
+	if err != nil {
+		d.t.Fatalf("failed to create docker client: %v", err)
+	}
+	return cli
+}
+
+// lookup finds a container by ID or name. The caller must hold d.mu.
+func (d *fakeDocker) lookup(ref string) *fakeContainer {
+	if c, ok := d.containers[ref]; ok {
+		return c
+	}
+	for _, c := range d.containers {
+		if c.Name == ref {
+			return c
+		}
+	}
+	return nil
+}
+
+// container returns a copy of the named container, or nil.
+func (d *fakeDocker) container(ref string) *fakeContainer {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if c := d.lookup(ref); c != nil {
+		cp := *c
+		return &cp
+	}
+	return nil
+}
+
+// setHealth changes the health status of a container.
+func (d *fakeDocker) setHealth(ref, health string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if c := d.lookup(ref); c != nil {
+		c.Health = health
+	}
+}
+
+// remove deletes a container, as AutoRemove does when it exits.
+func (d *fakeDocker) remove(ref string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if c := d.lookup(ref); c != nil {
+		delete(d.containers, c.ID)
+	}
+}
+
+// addContainer registers a running container, as if left behind by a previous run.
+func (d *fakeDocker) addContainer(name string, labels map[string]string) *fakeContainer {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.nextID++
+	c := &fakeContainer{
+		ID:     fmt.Sprintf("container-%d", d.nextID),
+		Name:   name,
+		Labels: labels,
+		Status: "running",
+		Health: "healthy",
+	}
+	d.containers[c.ID] = c
+	return c
+}
+
+// crash removes a container as if it died, emitting the events Docker would.
+func (d *fakeDocker) crash(ref string) {
+	c := d.container(ref)
+	if c == nil {
+		return
+	}
+	d.remove(ref)
+	d.emit(c.ID, events.ActionDie)
+	d.emit(c.ID, events.ActionDestroy)
+}
+
+// emit sends a container event to the events stream.
+func (d *fakeDocker) emit(containerID string, action events.Action) {
+	d.events <- events.Message{
+		Type:   events.ContainerEventType,
+		Action: action,
+		Actor:  events.Actor{ID: containerID},
+	}
+}
+
+// blockCreate holds creation of the named container until the returned func is called.
+func (d *fakeDocker) blockCreate(name string) (release func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	gate := make(chan struct{})
+	d.gates[name] = gate
+	return sync.OnceFunc(func() { close(gate) })
+}
+
+func (d *fakeDocker) createCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.creates
+}
+
+func (d *fakeDocker) handleCreate(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	d.createStarted <- name
+
+	d.mu.Lock()
+	gate := d.gates[name]
+	d.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+
+	var body struct {
+		Env    []string
+		Labels map[string]string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeDockerJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.lookup(name) != nil {
+		writeDockerJSON(w, http.StatusConflict, map[string]any{"message": "name in use"})
+		return
+	}
+
+	d.nextID++
+	d.creates++
+	c := &fakeContainer{
+		ID:     fmt.Sprintf("container-%d", d.nextID),
+		Name:   name,
+		Env:    body.Env,
+		Labels: body.Labels,
+		Status: "created",
+	}
+	d.containers[c.ID] = c
+
+	writeDockerJSON(w, http.StatusCreated, map[string]any{"Id": c.ID})
+}
+
+func (d *fakeDocker) inspectCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.inspects
+}
+
+func (d *fakeDocker) handleList(w http.ResponseWriter, r *http.Request) {
+	// Only label filters of the form key=value are supported
+	var filter map[string]map[string]bool
+	if raw := r.URL.Query().Get("filters"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &filter); err != nil {
+			writeDockerJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+			return
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	list := []map[string]any{}
+	for _, c := range d.containers {
+		match := true
+		for label := range filter["label"] {
+			key, value, _ := strings.Cut(label, "=")
+			if c.Labels[key] != value {
+				match = false
+			}
+		}
+		if match {
+			list = append(list, map[string]any{
+				"Id":     c.ID,
+				"Names":  []string{"/" + c.Name},
+				"Labels": c.Labels,
+				"State":  c.Status,
+			})
+		}
+	}
+
+	writeDockerJSON(w, http.StatusOK, list)
+}
+
+func (d *fakeDocker) handleRemove(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c := d.lookup(r.PathValue("id"))
+	if c == nil {
+		writeDockerJSON(w, http.StatusNotFound, map[string]any{"message": "No such container"})
+		return
+	}
+
+	delete(d.containers, c.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (d *fakeDocker) handleInspect(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.inspects++
+
+	c := d.lookup(r.PathValue("id"))
+	if c == nil {
+		writeDockerJSON(w, http.StatusNotFound, map[string]any{"message": "No such container"})
+		return
+	}
+
+	state := map[string]any{
+		"Status":  c.Status,
+		"Running": c.Status == "running",
+	}
+	if c.Health != "" {
+		state["Health"] = map[string]any{"Status": c.Health}
+	}
+
+	writeDockerJSON(w, http.StatusOK, map[string]any{
+		"Id":     c.ID,
+		"Name":   "/" + c.Name,
+		"State":  state,
+		"Config": map[string]any{"Env": c.Env, "Labels": c.Labels},
+	})
+}
+
+func (d *fakeDocker) handleArchive(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c := d.lookup(r.PathValue("id"))
+	if c == nil {
+		writeDockerJSON(w, http.StatusNotFound, map[string]any{"message": "No such container"})
+		return
+	}
+
+	tr := tar.NewReader(r.Body)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeDockerJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+			return
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, _ := io.ReadAll(tr)
+		if c.Files == nil {
+			c.Files = make(map[string]string)
+		}
+		c.Files[path.Join(r.URL.Query().Get("path"), hdr.Name)] = string(data)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (d *fakeDocker) handleStart(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c := d.lookup(r.PathValue("id"))
+	if c == nil {
+		writeDockerJSON(w, http.StatusNotFound, map[string]any{"message": "No such container"})
+		return
+	}
+
+	c.Status = "running"
+	c.Health = d.startHealth
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (d *fakeDocker) handleStop(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c := d.lookup(r.PathValue("id"))
+	if c == nil {
+		writeDockerJSON(w, http.StatusNotFound, map[string]any{"message": "No such container"})
+		return
+	}
+
+	// Containers are created with AutoRemove, so stopping removes them
+	delete(d.containers, c.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (d *fakeDocker) handleEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg := <-d.events:
+			enc.Encode(msg)
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+func writeDockerJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// newTestGluetunProvider returns a GluetunProvider backed by d.
+func newTestGluetunProvider(t *testing.T, d *fakeDocker, opts ...GluetunOption) *GluetunProvider {
+	t.Helper()
+
+	opts = append([]GluetunOption{
+		WithDockerClient(d.client()),
+		WithNetwork("geoswitch-test"),
+	}, opts...)
+
+	p, err := NewGluetunProvider(opts...)
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+	t.Cleanup(func() { p.Close(context.Background()) })
+	return p
+}
+
+// envValue returns the value of key in a container environment.
+func envValue(env []string, key string) string {
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == key {
+			return v
+		}
+	}
+	return ""
+}
@@ -1,14 +1,23 @@
 package provider
 
 import (
+	"archive/tar"
+	"bytes"
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"geoswitch/internal/config"
@@ -22,19 +31,78 @@ import (
 
 type exitRuntime struct {
 	handler       http.Handler
+	transport     *http.Transport // to the container's HTTP proxy
+	egress        egress          // public address, set before the runtime is published
 	containerID   string
 	containerName string
 	cancelLogs    context.CancelFunc
+	created       time.Time
+	cfg           config.ExitConfig // configuration the runtime was started with
+
+	health   atomic.Value // string, last health reported by the monitor
+	failures int          // consecutive unhealthy checks, owned by the monitor
+
+	active   atomic.Int64 // requests currently being served through this runtime
+	lastUsed atomic.Int64 // unix nanoseconds the last request started or finished, 0 if never used
+}
+
+// track wraps next so that requests served through it are counted as active.
+func (rt *exitRuntime) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rt.active.Add(1)
+		rt.touch()
+		defer func() {
+			rt.touch()
+			rt.active.Add(-1)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// touch records that the runtime is being used now.
+func (rt *exitRuntime) touch() {
+	rt.lastUsed.Store(time.Now().UnixNano())
+}
+
+// drainTimeout bounds how long stopping an exit waits for in-flight requests,
+// which include CONNECT tunnels that may stay open for minutes.
+var drainTimeout = 20 * time.Second
+
+// drain waits until no requests are active on the runtime or ctx is done.
+func (rt *exitRuntime) drain(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for rt.active.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
 }
 
 type gluetunConfig struct {
-	network      *string
-	imageVersion string
+	network        *string
+	imageVersion   string
+	docker         *client.Client
+	healthInterval time.Duration
+	ownerID        string
+	ipEchoURL      string
 }
 
 // GluetunOption is a functional option for configuring a GluetunProvider.
 type GluetunOption func(*gluetunConfig)
 
+// WithDockerClient sets the Docker client used to manage containers.
+// If not provided, a client is created from the DOCKER_* environment variables.
+func WithDockerClient(cli *client.Client) GluetunOption {
+	return func(c *gluetunConfig) {
+		c.docker = cli
+	}
+}
+
 // WithNetwork sets a custom Docker network name.
 // If not provided, the network is auto-detected from the current container.
 func WithNetwork(network string) GluetunOption {
@@ -51,12 +119,72 @@ func WithImageVersion(version string) GluetunOption {
 	}
 }
 
+// WithHealthInterval sets how often running containers are checked for health.
+// If not provided, defaults to 10 seconds.
+func WithHealthInterval(interval time.Duration) GluetunOption {
+	return func(c *gluetunConfig) {
+		c.healthInterval = interval
+	}
+}
+
+// WithOwnerID sets the owner label put on containers created by the provider.
+// Only containers with this owner are adopted or cleaned up, so several
+// GeoSwitch instances can share a Docker daemon by using different IDs.
+// If not provided, defaults to "geoswitch".
+func WithOwnerID(id string) GluetunOption {
+	return func(c *gluetunConfig) {
+		c.ownerID = id
+	}
+}
+
+// WithIPEchoURL sets a service that reports the caller's public IP, e.g.
+// "https://ifconfig.co/json". It is requested through every exit once it is
+// healthy to record the exit's egress IP and country. If not provided, egress
+// is not checked.
+func WithIPEchoURL(echoURL string) GluetunOption {
+	return func(c *gluetunConfig) {
+		c.ipEchoURL = echoURL
+	}
+}
+
+// startup is an in-progress exit startup. Concurrent requests for the same
+// cold exit wait on one startup instead of each creating a container.
+// Runtimes and startups are keyed by exit name, or by member name for the
+// members of a pool exit.
+type startup struct {
+	done chan struct{}
+	pool string // pool exit of the member being started, if any
+	rt   *exitRuntime
+	err  error
+}
+
 type GluetunProvider struct {
+	// mu guards runtimes, starting and pools. It is never held across Docker
+	// calls, so a slow startup of one exit does not block requests to other exits.
 	mu       sync.Mutex
 	runtimes map[string]*exitRuntime
-	docker   *client.Client
-	network  string
-	image    string
+	starting map[string]*startup
+	pools    map[string]*pool // by exit name
+	closed   bool
+
+	// setupMu serialises network and image setup between concurrent startups
+	setupMu sync.Mutex
+
+	// ctx is cancelled by Close to abort startups still in progress
+	// and stop background goroutines such as the health monitor
+	ctx        context.Context
+	cancel     context.CancelFunc
+	startups   sync.WaitGroup
+	background sync.WaitGroup
+
+	docker    *client.Client
+	network   string
+	image     string
+	owner     string
+	ipEchoURL string
+
+	// proxyAddr returns the address of a container's HTTP proxy; replaced in tests
+	proxyAddr func(containerName string) string
 }
 
 func (p *GluetunProvider) GetHandler(
@@ -65,91 +193,242 @@ func (p *GluetunProvider) GetHandler(
 	cfg config.ExitConfig,
 ) (http.Handler, error) {
 
+	if cfg.IsPool() {
+		return p.poolHandler(ctx, exitName, cfg)
+	}
+
 	p.mu.Lock()
-	defer p.mu.Unlock()
+	rt, ok := p.runtimes[exitName]
+	if ok {
+		// Marked as used under the lock, so the reaper cannot stop it before the request starts
+		rt.touch()
+	}
+	p.mu.Unlock()
 
-	if rt, ok := p.runtimes[exitName]; ok {
-		log.Printf("[gluetun] reusing cached handler for exit '%s'", exitName)
+	if ok {
+		// Health is kept up to date by the monitor, so no Docker call is needed here
+		if !rt.available() {
+			return nil, fmt.Errorf("exit '%s' not healthy", exitName)
+		}
+		return rt.handler, nil
+	}
+
+	rt, err := p.ensureRuntime(ctx, exitName, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return rt.handler, nil
+}
 
-		inspect, err := p.docker.ContainerInspect(ctx, rt.containerID)
+// StartExit starts the container for exitName, or all containers of a pool
+// exit, and waits for them to become healthy. A pool has started once
+// min_ready of its members have, all of them by default; the others carry on
+// starting in the background. Starting an exit that
+// already has a runtime is a no-op.
+func (p *GluetunProvider) StartExit(ctx context.Context, exitName string, cfg config.ExitConfig) error {
+	if cfg.IsPool() {
+		pl := p.poolFor(exitName, cfg)
+		required := cmp.Or(cfg.MinReady, len(pl.members))
+		started, err := p.startPool(ctx, pl, required)
+		if started < required {
+			return fmt.Errorf("exit '%s': %d of %d pool members started, %d required: %w",
+				exitName, started, len(pl.members), required, err)
+		}
 		if err != nil {
-			return nil, err
+			log.Printf("[gluetun] pool '%s' started with %d of %d members: %v", exitName, started, len(pl.members), err)
 		}
+		return nil
+	}
 
-		if inspect.State.Health != nil &&
-			inspect.State.Health.Status != "healthy" {
-			return nil, fmt.Errorf("exit '%s' not healthy", exitName)
-		}
+	_, err := p.ensureRuntime(ctx, exitName, cfg)
+	return err
+}
 
-		return rt.handler, nil
+// ensureRuntime returns the runtime for exitName, starting it if needed. If a
+// startup is already in progress the caller waits for it rather than starting
+// another. ctx only bounds the wait: the startup itself outlives the caller so
+// that other waiters are not affected by one cancelled request.
+func (p *GluetunProvider) ensureRuntime(
+	ctx context.Context,
+	exitName string,
+	cfg config.ExitConfig,
+) (*exitRuntime, error) {
+
+	p.mu.Lock()
+	rt, s, err := p.beginStartup(exitName, cfg)
+	p.mu.Unlock()
+
+	if rt != nil || err != nil {
+		return rt, err
+	}
+
+	select {
+	case <-s.done:
+		return s.rt, s.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
+}
+
+// beginStartup returns the runtime for exitName if there is one, and otherwise
+// the startup that will provide it, starting one if none is in progress.
+// The caller must hold p.mu.
+func (p *GluetunProvider) beginStartup(exitName string, cfg config.ExitConfig) (*exitRuntime, *startup, error) {
+	if p.closed {
+		return nil, nil, fmt.Errorf("gluetun provider is closed")
+	}
+	if rt, ok := p.runtimes[exitName]; ok {
+		return rt, nil, nil
+	}
+
+	s, ok := p.starting[exitName]
+	if ok {
+		log.Printf("[gluetun] waiting for in-progress startup of exit '%s'", exitName)
+	} else {
+		s = &startup{done: make(chan struct{}), pool: cfg.Pool}
+		p.starting[exitName] = s
+		p.startups.Add(1)
+		go p.runStartup(exitName, cfg, s)
+	}
+	return nil, s, nil
+}
+
+// runStartup performs a startup and publishes its result to all waiters.
+func (p *GluetunProvider) runStartup(exitName string, cfg config.ExitConfig, s *startup) {
+	defer p.startups.Done()
+
+	rt, err := p.startRuntime(p.ctx, exitName, cfg)
+
+	p.mu.Lock()
+	delete(p.starting, exitName)
+	if err == nil {
+		p.runtimes[exitName] = rt
+	}
+	p.mu.Unlock()
+
+	s.rt, s.err = rt, err
+	close(s.done)
+}
+
+// RestartExit stops the runtime of exitName, if any, and starts a fresh one.
+func (p *GluetunProvider) RestartExit(ctx context.Context, exitName string, cfg config.ExitConfig) error {
+	log.Printf("[gluetun] restarting exit '%s'", exitName)
+	if err := p.StopExit(ctx, exitName); err != nil {
+		return err
+	}
+	return p.StartExit(ctx, exitName, cfg)
+}
+
+// startRuntime creates (or reuses) the container for exitName and waits for it
+// to become healthy. It does not touch p.runtimes; runStartup publishes the result.
+func (p *GluetunProvider) startRuntime(
+	ctx context.Context,
+	exitName string,
+	cfg config.ExitConfig,
+) (*exitRuntime, error) {
 
 	log.Printf("[gluetun] creating new handler for exit '%s' (country=%s)", exitName, cfg.Country)
 
-	if err := p.ensureNetwork(ctx); err != nil {
+	p.setupMu.Lock()
+	err := p.ensureNetwork(ctx)
+	p.setupMu.Unlock()
+	if err != nil {
 		log.Printf("[gluetun] failed to ensure network: %v", err)
 		return nil, err
 	}
 
-	containerName := "gluetun-" + exitName
+	containerName := containerNameFor(exitName)
 	var containerID string
 
-	// Check if container already exists
+	// Reuse an existing container only if it was created by us with the same settings
 	resp, err := p.docker.ContainerInspect(ctx, containerName)
-	if err != nil {
-		log.Printf("[gluetun] container '%s' does not exist, creating it", containerName)
+	if err == nil && p.matches(resp.Config.Labels, exitName, cfg) {
+		log.Printf("[gluetun] reusing existing container '%s'", containerName)
+		containerID = resp.ID
+	} else {
+		if err == nil {
+			if owner := resp.Config.Labels[labelOwner]; owner != "" && owner != p.owner {
+				return nil, fmt.Errorf("container '%s' belongs to another GeoSwitch instance (owner '%s')", containerName, owner)
+			}
+			log.Printf("[gluetun] container '%s' has stale settings, replacing it", containerName)
+			if err := p.removeContainer(ctx, resp.ID); err != nil {
+				return nil, err
+			}
+		} else {
+			log.Printf("[gluetun] container '%s' does not exist, creating it", containerName)
+		}
+
 		// Pull image if it doesn't exist
-		if err := p.ensureImage(ctx); err != nil {
+		p.setupMu.Lock()
+		err := p.ensureImage(ctx)
+		p.setupMu.Unlock()
+		if err != nil {
 			return nil, err
 		}
 		// Create and start container
-		containerID, err = p.createContainer(ctx, containerName, cfg)
+		containerID, err = p.createContainer(ctx, exitName, cfg)
 		if err != nil {
 			return nil, err
 		}
-	} else {
-		log.Printf("[gluetun] reusing existing container '%s'", containerName)
-		containerID = resp.ID
 	}
 
-	// Track the runtime immediately so Close() can clean it up if health check fails
-	rt := &exitRuntime{
-		containerID:   containerID,
-		containerName: containerName,
-	}
-	p.runtimes[exitName] = rt
-
-	// Write logs to main logger
-	cancelLogs := p.streamLogs(containerID)
-	rt.cancelLogs = cancelLogs
+	rt := p.newRuntime(containerID, containerName, cfg)
+	cancelLogs := rt.cancelLogs
 
 	// Wait for container to become healthy
-	if err := p.waitForHealthy(ctx, containerName, 60*time.Second); err != nil {
+	health, err := p.waitForHealthy(ctx, rt, cfg)
+	if err != nil {
 		log.Printf("[gluetun] container '%s' failed health check: %v", containerName, err)
 		// Clean up on failure
 		cancelLogs()
-		delete(p.runtimes, exitName)
 		stopCtx, stopCancel := context.WithTimeout(context.Background(), 10*time.Second)
 		p.docker.ContainerStop(stopCtx, containerID, container.StopOptions{})
 		stopCancel()
 		return nil, err
 	}
+	rt.health.Store(health)
+
+	if err := p.verifyEgress(ctx, exitName, rt, cfg); err != nil {
+		log.Printf("[gluetun] refusing to serve exit '%s': %v", exitName, err)
+		cancelLogs()
+		stopCtx, stopCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		p.docker.ContainerStop(stopCtx, containerID, container.StopOptions{})
+		stopCancel()
+		return nil, err
+	}
+
+	log.Printf("[gluetun] handler created and cached for exit '%s'", exitName)
+	return rt, nil
+}
+
+// newRuntime builds the runtime for a started container, proxying requests and
+// CONNECT tunnels through its HTTP proxy and streaming its logs to the main logger.
+func (p *GluetunProvider) newRuntime(containerID, containerName string, cfg config.ExitConfig) *exitRuntime {
+	rt := &exitRuntime{
+		containerID:   containerID,
+		containerName: containerName,
+		created:       time.Now(),
+		cfg:           cfg,
+	}
 
-	// Create reverse proxy
 	proxyURL := &url.URL{
 		Scheme: "http",
-		Host:   containerName + ":8888",
+		Host:   p.proxyAddr(containerName),
 	}
 
-	transport := &http.Transport{
+	rt.transport = &http.Transport{
 		Proxy: http.ProxyURL(proxyURL),
 	}
 
-	handler := proxy.NewReverseProxy(proxy.WithTransport(transport))
+	tunnel := &proxy.HTTPConnectDialer{
+		ProxyURL: proxyURL,
+		Forward:  &net.Dialer{Timeout: 30 * time.Second},
+	}
 
-	rt.handler = handler
-	log.Printf("[gluetun] handler created and cached for exit '%s'", exitName)
-	return handler, nil
+	handler := proxy.NewConnectHandler(proxy.NewReverseProxy(proxy.WithTransport(rt.transport)), tunnel.DialContext)
+	rt.handler = rt.track(rt.withEgressHeaders(handler))
+	rt.cancelLogs = p.streamLogs(containerID)
+	return rt
 }
 
 func (p *GluetunProvider) ensureNetwork(ctx context.Context) error {
@@ -189,26 +468,21 @@ func (p *GluetunProvider) ensureImage(ctx context.Context) error {
 
 func (p *GluetunProvider) createContainer(
 	ctx context.Context,
-	name string,
+	exitName string,
 	cfg config.ExitConfig,
 ) (string, error) {
 
+	name := containerNameFor(exitName)
 	log.Printf("[gluetun] creating container '%s' with %s", name, p.image)
 
-	env := []string{
-		"HTTPPROXY=on",
-		"SERVER_COUNTRIES=" + cfg.Country,
-		// Temp solution for testing. Env vars should be consumed in main, or referenced in config.yaml
-		"VPN_SERVICE_PROVIDER=" + getEnv("VPN_SERVICE_PROVIDER"),
-		"OPENVPN_USER=" + getEnv("OPENVPN_USER"),
-		"OPENVPN_PASSWORD=" + getEnv("OPENVPN_PASSWORD"),
-	}
+	env := gluetunEnv(cfg)
 
 	resp, err := p.docker.ContainerCreate(
 		ctx,
 		&container.Config{
-			Image: p.image,
-			Env:   env,
+			Image:  p.image,
+			Env:    env,
+			Labels: p.labels(exitName, cfg),
 		},
 		&container.HostConfig{
 			AutoRemove: true,
@@ -236,6 +510,12 @@ func (p *GluetunProvider) createContainer(
 		return "", err
 	}
 
+	if err := p.copySecrets(ctx, resp.ID, cfg); err != nil {
+		log.Printf("[gluetun] failed to copy credentials into container '%s': %v", name, err)
+		p.removeContainer(context.Background(), resp.ID)
+		return "", err
+	}
+
 	log.Printf("[gluetun] starting container '%s' (ID: %s)", name, resp.ID)
 	err = p.docker.ContainerStart(ctx, resp.ID, container.StartOptions{})
 	if err != nil {
@@ -246,6 +526,20 @@ func (p *GluetunProvider) createContainer(
 	return resp.ID, nil
 }
 
+// copySecrets puts the VPN credentials of cfg into a created container.
+func (p *GluetunProvider) copySecrets(ctx context.Context, containerID string, cfg config.ExitConfig) error {
+	secrets := gluetunSecrets(cfg)
+	if len(secrets) == 0 {
+		return nil
+	}
+
+	archive, err := secretsArchive(secrets)
+	if err != nil {
+		return err
+	}
+	return p.docker.CopyToContainer(ctx, containerID, "/", archive, container.CopyToContainerOptions{})
+}
+
 func (p *GluetunProvider) streamLogs(containerID string) context.CancelFunc {
 	logCtx, cancel := context.WithCancel(context.Background())
 	go func() {
@@ -266,67 +560,300 @@ func (p *GluetunProvider) streamLogs(containerID string) context.CancelFunc {
 	return cancel
 }
 
+// Defaults for the health settings of an exit.
+const (
+	defaultStartupTimeout     = 60 * time.Second
+	defaultHealthPollInterval = time.Second
+)
+
+// waitForHealthy waits until the runtime's container reports healthy and, if
+// the exit has a probe URL, a request through it succeeds. It returns the
+// container health to cache for the runtime.
 func (p *GluetunProvider) waitForHealthy(
 	ctx context.Context,
-	containerName string,
-	timeout time.Duration,
-) error {
+	rt *exitRuntime,
+	cfg config.ExitConfig,
+) (string, error) {
+
+	timeout := cmp.Or(cfg.StartupTimeout, defaultStartupTimeout)
+	interval := cmp.Or(cfg.HealthPollInterval, defaultHealthPollInterval)
 
-	deadline := time.Now().Add(timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	health, err := p.waitForContainer(ctx, rt.containerName, cfg, interval)
+	if err != nil {
+		return "", err
+	}
+
+	if cfg.ProbeURL == "" {
+		return health, nil
+	}
 
 	for {
-		if time.Now().After(deadline) {
-			return fmt.Errorf("container %s did not become healthy in time", containerName)
+		err := probe(ctx, rt.transport, cfg.ProbeURL)
+		if err == nil {
+			log.Printf("[gluetun] probe of %s through '%s' succeeded", cfg.ProbeURL, rt.containerName)
+			return health, nil
 		}
+		log.Printf("[gluetun] probe through '%s' failed: %v", rt.containerName, err)
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("container %s did not pass its probe in time: %w", rt.containerName, err)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// waitForContainer polls the container until Docker reports it healthy, or
+// running if it has no healthcheck and the exit's policy allows that.
+func (p *GluetunProvider) waitForContainer(
+	ctx context.Context,
+	containerName string,
+	cfg config.ExitConfig,
+	interval time.Duration,
+) (string, error) {
 
+	for {
 		inspect, err := p.docker.ContainerInspect(ctx, containerName)
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("container %s did not become healthy in time", containerName)
+		}
 		if err != nil {
-			return err
+			return "", err
 		}
 
-		if inspect.State == nil || inspect.State.Health == nil {
-			return fmt.Errorf("container %s has no healthcheck configured", containerName)
+		switch {
+		case inspect.State == nil || inspect.State.Health == nil:
+			if cfg.MissingHealthcheck != config.MissingHealthcheckAssumeHealthy {
+				return "", fmt.Errorf("container %s has no healthcheck configured", containerName)
+			}
+			if inspect.State != nil && inspect.State.Running {
+				log.Printf("[gluetun] container '%s' has no healthcheck, assuming healthy", containerName)
+				return healthRunning, nil
+			}
+
+		case inspect.State.Health.Status == healthHealthy:
+			log.Printf("[gluetun] container '%s' is healthy", containerName)
+			return healthHealthy, nil
+
+		case inspect.State.Health.Status == "unhealthy":
+			return "", fmt.Errorf("container %s is unhealthy", containerName)
 		}
 
-		status := inspect.State.Health.Status
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("container %s did not become healthy in time", containerName)
+		case <-time.After(interval):
+		}
+	}
+}
 
-		switch status {
-		case "healthy":
-			log.Printf("[gluetun] container '%s' is healthy", containerName)
-			return nil
+// probe makes a GET request to probeURL through transport, succeeding on any
+// non-error response status.
+func probe(ctx context.Context, transport http.RoundTripper, probeURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL, nil)
+	if err != nil {
+		return err
+	}
 
-		case "unhealthy":
-			return fmt.Errorf("container %s is unhealthy", containerName)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
 
-		case "starting":
-			time.Sleep(1 * time.Second)
-		}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("probe returned status %d", resp.StatusCode)
 	}
+	return nil
 }
 
-// Close cleans up all resources including stopping containers and removing the network.
-func (p *GluetunProvider) Close(ctx context.Context) error {
+// ExitStatus reports the runtime state of exitName with the health last seen by
+// the monitor. Pool exits report the state of each member as well.
+func (p *GluetunProvider) ExitStatus(_ context.Context, exitName string, cfg config.ExitConfig) (ExitStatus, bool) {
+	if cfg.IsPool() {
+		return p.poolStatus(exitName, cfg), true
+	}
+	return p.runtimeStatus(exitName), true
+}
+
+// runtimeStatus reports the state of a single runtime.
+func (p *GluetunProvider) runtimeStatus(exitName string) ExitStatus {
+	p.mu.Lock()
+	rt, ok := p.runtimes[exitName]
+	_, starting := p.starting[exitName]
+	p.mu.Unlock()
+
+	if starting {
+		return ExitStatus{State: StateStarting, ContainerName: containerNameFor(exitName)}
+	}
+
+	if !ok {
+		return ExitStatus{State: StateStopped}
+	}
+
+	status := ExitStatus{
+		State:         StateRunning,
+		ContainerID:   rt.containerID,
+		ContainerName: rt.containerName,
+		CreatedAt:     rt.created,
+		Health:        rt.healthStatus(),
+		EgressIP:      rt.egress.IP,
+		EgressCountry: rt.egress.displayCountry(),
+	}
+	if lastUsed := rt.lastUsed.Load(); lastUsed > 0 {
+		status.LastUsedAt = time.Unix(0, lastUsed)
+	}
+
+	return status
+}
+
+// UpdateExit applies cfg to the running runtime of exitName, or to the
+// running members of a pool exit, without restarting them. It is meant for
+// settings that do not affect the container, such as idle_timeout or eager;
+// pools pick up a new balance on their next request.
+func (p *GluetunProvider) UpdateExit(exitName string, cfg config.ExitConfig) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	log.Printf("[gluetun] shutting down provider, cleaning up %d runtimes", len(p.runtimes))
+	if rt, ok := p.runtimes[exitName]; ok {
+		rt.cfg = cfg
+	}
+	for _, member := range cfg.PoolMembers(exitName) {
+		if rt, ok := p.runtimes[member.Name]; ok {
+			rt.cfg = member.Exit
+		}
+	}
+}
 
-	// Stop all running containers
-	for exitName, rt := range p.runtimes {
-		log.Printf("[gluetun] stopping container '%s' for exit '%s'", rt.containerName, exitName)
-		// Cancel log streaming first
-		if rt.cancelLogs != nil {
-			rt.cancelLogs()
+// StopExit removes the runtime for exitName, waits for its in-flight requests
+// to finish (or ctx to expire) and stops its container. All members of a pool
+// exit are stopped in parallel, including members adopted by Reconcile before
+// the pool served a request. The next request for the exit creates a fresh
+// runtime. Stopping an exit with no runtime is a no-op.
+func (p *GluetunProvider) StopExit(ctx context.Context, exitName string) error {
+	p.mu.Lock()
+	delete(p.pools, exitName)
+	keys := []string{exitName}
+	for key, rt := range p.runtimes {
+		if rt.cfg.Pool == exitName {
+			keys = append(keys, key)
 		}
-		stopCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-		err := p.docker.ContainerStop(stopCtx, rt.containerID, container.StopOptions{})
-		cancel()
-		if err != nil {
-			log.Printf("[gluetun] error stopping container '%s': %v", rt.containerName, err)
+	}
+	for key, s := range p.starting {
+		if s.pool == exitName {
+			keys = append(keys, key)
 		}
 	}
+	p.mu.Unlock()
+
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = p.stopMember(ctx, key)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
 
+// stopMember drains and stops a single runtime, keyed by exit or member name.
+func (p *GluetunProvider) stopMember(ctx context.Context, exitName string) error {
+	// Let a startup in progress finish first, so its runtime does not outlive the stop
+	p.mu.Lock()
+	s, starting := p.starting[exitName]
+	p.mu.Unlock()
+	if starting {
+		select {
+		case <-s.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	p.mu.Lock()
+	rt, ok := p.runtimes[exitName]
+	delete(p.runtimes, exitName)
+	p.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	log.Printf("[gluetun] draining exit '%s' (%d active requests)", exitName, rt.active.Load())
+	drainCtx, cancel := context.WithTimeout(ctx, drainTimeout)
+	err := rt.drain(drainCtx)
+	cancel()
+	if err != nil {
+		log.Printf("[gluetun] exit '%s' did not drain in time, stopping anyway", exitName)
+	}
+
+	// The runtime is no longer tracked, so stop it even if ctx has expired
+	return p.stopRuntime(context.Background(), exitName, rt)
+}
+
+// stopRuntime cancels log streaming and stops the runtime's container.
+func (p *GluetunProvider) stopRuntime(ctx context.Context, exitName string, rt *exitRuntime) error {
+	log.Printf("[gluetun] stopping container '%s' for exit '%s'", rt.containerName, exitName)
+	// Cancel log streaming first
+	if rt.cancelLogs != nil {
+		rt.cancelLogs()
+	}
+	stopCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	err := p.docker.ContainerStop(stopCtx, rt.containerID, container.StopOptions{})
+	if err != nil {
+		log.Printf("[gluetun] error stopping container '%s': %v", rt.containerName, err)
+		return err
+	}
+
+	// Containers are auto-removed; wait for that so the name can be reused straight away
+	waitCh, errCh := p.docker.ContainerWait(stopCtx, rt.containerID, container.WaitConditionRemoved)
+	select {
+	case <-waitCh:
+	case <-errCh:
+		// Already removed, or the wait timed out; either way there is nothing left to do
+	}
+	return nil
+}
+
+// Close cleans up all resources including stopping containers and removing the network.
+func (p *GluetunProvider) Close(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	// Abort startups in progress and background work, and wait for them to
+	// clean up their containers
+	p.cancel()
+	p.background.Wait()
+	p.startups.Wait()
+
+	// Take the runtimes out under the lock and stop them outside it, so status
+	// requests are not blocked while containers stop
+	p.mu.Lock()
+	runtimes := p.runtimes
 	p.runtimes = make(map[string]*exitRuntime)
+	p.mu.Unlock()
+
+	log.Printf("[gluetun] shutting down provider, cleaning up %d runtimes", len(runtimes))
+
+	// Stop all running containers in parallel
+	var wg sync.WaitGroup
+	for exitName, rt := range runtimes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.stopRuntime(ctx, exitName, rt)
+		}()
+	}
+	wg.Wait()
 
 	// Close Docker client
 	log.Printf("[gluetun] closing docker client")
@@ -335,21 +862,27 @@ func (p *GluetunProvider) Close(ctx context.Context) error {
 
 func NewGluetunProvider(opts ...GluetunOption) (*GluetunProvider, error) {
 	config := &gluetunConfig{
-		imageVersion: "qmcgaw/gluetun:latest",
-		network:      nil, // nil means auto-detect
+		imageVersion:   "qmcgaw/gluetun:latest",
+		ownerID:        "geoswitch",
+		network:        nil, // nil means auto-detect
+		healthInterval: 10 * time.Second,
 	}
 
 	for _, opt := range opts {
 		opt(config)
 	}
 
-	cli, err := client.NewClientWithOpts(
-		client.FromEnv,
-		client.WithAPIVersionNegotiation(),
-	)
-	if err != nil {
-		log.Printf("[gluetun] failed to create docker client: %v", err)
-		return nil, err
+	cli := config.docker
+	if cli == nil {
+		var err error
+		cli, err = client.NewClientWithOpts(
+			client.FromEnv,
+			client.WithAPIVersionNegotiation(),
+		)
+		if err != nil {
+			log.Printf("[gluetun] failed to create docker client: %v", err)
+			return nil, err
+		}
 	}
 
 	// Auto-detect network if not specified
@@ -368,16 +901,144 @@ func NewGluetunProvider(opts ...GluetunOption) (*GluetunProvider, error) {
 	}
 
 	log.Printf("[gluetun] docker client initialised successfully")
-	return &GluetunProvider{
+	ctx, cancel := context.WithCancel(context.Background())
+
+	p := &GluetunProvider{
 		runtimes: make(map[string]*exitRuntime),
+		starting: make(map[string]*startup),
+		pools:    make(map[string]*pool),
+		ctx:      ctx,
+		cancel:   cancel,
 		docker:   cli,
 		network:  networkName,
 		image:    config.imageVersion,
-	}, nil
+		owner:    config.ownerID,
+		proxyAddr: func(containerName string) string {
+			return containerName + ":8888"
+		},
+		ipEchoURL: config.ipEchoURL,
+	}
+
+	p.background.Add(2)
+	go p.monitorHealth(config.healthInterval)
+	go p.watchEvents()
+
+	return p, nil
 }
 
-func getEnv(key string) string {
-	return os.Getenv(key)
+// gluetunEnv builds the container environment for an exit from its Gluetun settings.
+// Extra variables are appended in sorted order so the environment is deterministic.
+func gluetunEnv(cfg config.ExitConfig) []string {
+	env := []string{
+		"HTTPPROXY=on",
+		"SERVER_COUNTRIES=" + cfg.Country,
+	}
+
+	g := cfg.Gluetun
+	if g == nil {
+		return env
+	}
+
+	vpnType := g.VPNType
+	if vpnType == "" {
+		vpnType = config.VPNTypeOpenVPN
+	}
+
+	env = append(env,
+		"VPN_SERVICE_PROVIDER="+g.ServiceProvider,
+		"VPN_TYPE="+vpnType,
+	)
+
+	// Credentials are read from the files gluetunSecrets puts in the container
+	switch vpnType {
+	case config.VPNTypeOpenVPN:
+		env = append(env,
+			"OPENVPN_USER="+g.OpenVPNUser,
+			"OPENVPN_PASSWORD_SECRETFILE="+secretOpenVPNPassword,
+		)
+	case config.VPNTypeWireguard:
+		env = append(env, "WIREGUARD_PRIVATE_KEY_SECRETFILE="+secretWireguardPrivateKey)
+		if g.WireguardAddresses != "" {
+			env = append(env, "WIREGUARD_ADDRESSES="+g.WireguardAddresses)
+		}
+	}
+
+	if len(g.ServerCities) > 0 {
+		env = append(env, "SERVER_CITIES="+strings.Join(g.ServerCities, ","))
+	}
+	if len(g.ServerHostnames) > 0 {
+		env = append(env, "SERVER_HOSTNAMES="+strings.Join(g.ServerHostnames, ","))
+	}
+
+	keys := make([]string, 0, len(g.Env))
+	for key := range g.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = append(env, key+"="+g.Env[key])
+	}
+
+	return env
+}
+
+// Files Gluetun reads the VPN credentials from.
+const (
+	secretOpenVPNPassword     = "/run/secrets/openvpn_password"
+	secretWireguardPrivateKey = "/run/secrets/wireguard_private_key"
+)
+
+// gluetunSecrets returns the VPN credentials of an exit keyed by the file
+// Gluetun reads them from. They are copied into the container before it
+// starts, so they do not show up in its environment or in docker inspect.
+func gluetunSecrets(cfg config.ExitConfig) map[string]string {
+	g := cfg.Gluetun
+	if g == nil {
+		return nil
+	}
+
+	switch g.VPNType {
+	case "", config.VPNTypeOpenVPN:
+		return map[string]string{secretOpenVPNPassword: g.OpenVPNPassword}
+	case config.VPNTypeWireguard:
+		return map[string]string{secretWireguardPrivateKey: g.WireguardPrivateKey}
+	}
+	return nil
+}
+
+// secretsArchive packs secrets into a tar archive to be extracted at the
+// container's root, readable only by its root user.
+func secretsArchive(secrets map[string]string) (io.Reader, error) {
+	files := make([]string, 0, len(secrets))
+	for file := range secrets {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	dirs := make(map[string]bool)
+	for _, file := range files {
+		name := strings.TrimPrefix(file, "/")
+		if dir := path.Dir(name) + "/"; !dirs[dir] {
+			dirs[dir] = true
+			if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir, Mode: 0o700}); err != nil {
+				return nil, err
+			}
+		}
+
+		value := secrets[file]
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0o400, Size: int64(len(value))}); err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(tw, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
 }
 
 // detectCurrentNetwork determines which Docker network the current container is running on.
@@ -0,0 +1,200 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"geoswitch/internal/config"
+)
+
+// Response headers reporting the egress of the exit that served a request.
+const (
+	HeaderExitIP      = "X-GeoSwitch-Exit-IP"
+	HeaderExitCountry = "X-GeoSwitch-Exit-Country"
+)
+
+// egress is the public address of an exit as reported by the IP echo service.
+type egress struct {
+	IP          string
+	Country     string
+	CountryCode string
+}
+
+// fetchEgress requests echoURL through transport and parses the response.
+// JSON responses with "ip", "country" and "country_iso" or "country_code"
+// fields (as served by ifconfig.co/json or ipinfo-style services) are
+// supported, as are plain-text responses holding just the IP.
+func fetchEgress(ctx context.Context, transport http.RoundTripper, echoURL string) (egress, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, echoURL, nil)
+	if err != nil {
+		return egress{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return egress{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return egress{}, fmt.Errorf("echo service returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return egress{}, err
+	}
+
+	var parsed struct {
+		IP          string `json:"ip"`
+		Country     string `json:"country"`
+		CountryISO  string `json:"country_iso"`
+		CountryCode string `json:"country_code"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		// Not JSON; treat the body as a bare IP
+		parsed.IP = strings.TrimSpace(string(body))
+	}
+
+	if net.ParseIP(parsed.IP) == nil {
+		return egress{}, fmt.Errorf("echo service returned no valid IP")
+	}
+
+	e := egress{
+		IP:          parsed.IP,
+		Country:     parsed.Country,
+		CountryCode: parsed.CountryISO,
+	}
+	if e.CountryCode == "" {
+		e.CountryCode = parsed.CountryCode
+	}
+
+	// ipinfo-style services put the ISO code in "country"
+	if e.CountryCode == "" && len(e.Country) == 2 {
+		e.CountryCode = e.Country
+	}
+	return e, nil
+}
+
+// countryMatches reports whether the egress is in the configured country.
+// The configured country may be the exact country name or its ISO code, both
+// case-insensitive, or a common alias from countryAliases, so "Korea" matches
+// "South Korea" and "UK" matches "GB". Names are never matched partially, as
+// "Korea" is also part of "North Korea".
+func (e egress) countryMatches(country string) bool {
+	want := strings.ToLower(strings.TrimSpace(country))
+	if want == "" {
+		return false
+	}
+	if strings.EqualFold(e.Country, want) {
+		return true
+	}
+
+	code := countryCode(want)
+	return code != "" &&
+		(strings.EqualFold(e.CountryCode, code) || countryCode(strings.ToLower(e.Country)) == code)
+}
+
+// countryCode returns the ISO code of a lower-case country name, alias or
+// code, or "" if it is not known.
+func countryCode(name string) string {
+	if code, ok := countryAliases[name]; ok {
+		return code
+	}
+	if len(name) == 2 {
+		return strings.ToUpper(name)
+	}
+	return ""
+}
+
+// countryAliases maps the names exits are commonly configured with to ISO
+// codes, where they differ from what echo services report.
+var countryAliases = map[string]string{
+	"korea":                    "KR",
+	"south korea":              "KR",
+	"republic of korea":        "KR",
+	"north korea":              "KP",
+	"uk":                       "GB",
+	"united kingdom":           "GB",
+	"great britain":            "GB",
+	"britain":                  "GB",
+	"england":                  "GB",
+	"usa":                      "US",
+	"united states":            "US",
+	"united states of america": "US",
+	"america":                  "US",
+	"russia":                   "RU",
+	"russian federation":       "RU",
+	"netherlands":              "NL",
+	"the netherlands":          "NL",
+	"holland":                  "NL",
+	"czechia":                  "CZ",
+	"czech republic":           "CZ",
+	"uae":                      "AE",
+	"united arab emirates":     "AE",
+	"hong kong":                "HK",
+	"taiwan":                   "TW",
+	"vietnam":                  "VN",
+	"viet nam":                 "VN",
+}
+
+// verifyEgress records the egress of a freshly started runtime. With
+// verify_country set, an unknown egress or one in another country than the
+// exit's is an error, so the exit is not served.
+func (p *GluetunProvider) verifyEgress(ctx context.Context, exitName string, rt *exitRuntime, cfg config.ExitConfig) error {
+	if p.ipEchoURL == "" {
+		if cfg.VerifyCountry {
+			return fmt.Errorf("exit '%s': verify_country requires an IP echo URL", exitName)
+		}
+		return nil
+	}
+
+	e, err := fetchEgress(ctx, rt.transport, p.ipEchoURL)
+	if err != nil {
+		if cfg.VerifyCountry {
+			return fmt.Errorf("exit '%s': failed to determine egress: %w", exitName, err)
+		}
+		log.Printf("[gluetun] failed to determine egress of exit '%s': %v", exitName, err)
+		return nil
+	}
+
+	rt.egress = e
+	log.Printf("[gluetun] exit '%s' egress is %s (%s)", exitName, e.IP, e.displayCountry())
+
+	if cfg.VerifyCountry && !e.countryMatches(cfg.Country) {
+		return fmt.Errorf("exit '%s': egress %s is in '%s', expected '%s'", exitName, e.IP, e.displayCountry(), cfg.Country)
+	}
+	return nil
+}
+
+// withEgressHeaders wraps next to report the runtime's egress in response headers.
+func (rt *exitRuntime) withEgressHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rt.egress.IP != "" {
+			w.Header().Set(HeaderExitIP, rt.egress.IP)
+		}
+		if country := rt.egress.displayCountry(); country != "" {
+			w.Header().Set(HeaderExitCountry, country)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// displayCountry returns the most descriptive country of e for logs and headers.
+func (e egress) displayCountry() string {
+	if e.Country != "" {
+		return e.Country
+	}
+	return e.CountryCode
+}
@@ -0,0 +1,190 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// newEchoServer returns a stub IP echo service. It also stands in for the
+// container's HTTP proxy, answering every request with body.
+func newEchoServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchEgress(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want egress
+	}{
+		{
+			name: "ifconfig.co",
+			body: `{"ip":"203.0.113.7","country":"South Korea","country_iso":"KR"}`,
+			want: egress{IP: "203.0.113.7", Country: "South Korea", CountryCode: "KR"},
+		},
+		{
+			name: "ipinfo",
+			body: `{"ip":"203.0.113.7","country":"KR"}`,
+			want: egress{IP: "203.0.113.7", Country: "KR", CountryCode: "KR"},
+		},
+		{
+			name: "plain text",
+			body: "203.0.113.7\n",
+			want: egress{IP: "203.0.113.7"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newEchoServer(t, tt.body)
+
+			got, err := fetchEgress(context.Background(), http.DefaultTransport, srv.URL)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFetchEgress_InvalidIP(t *testing.T) {
+	srv := newEchoServer(t, "<html>blocked</html>")
+
+	if _, err := fetchEgress(context.Background(), http.DefaultTransport, srv.URL); err == nil {
+		t.Fatal("expected error for a response without an IP, got nil")
+	}
+}
+
+func TestEgress_CountryMatches(t *testing.T) {
+	e := egress{IP: "203.0.113.7", Country: "South Korea", CountryCode: "KR"}
+
+	for country, want := range map[string]bool{
+		"South Korea": true,
+		"korea":       true,
+		"KR":          true,
+		"Japan":       false,
+		"":            false,
+	} {
+		if got := e.countryMatches(country); got != want {
+			t.Errorf("countryMatches(%q) = %v, want %v", country, got, want)
+		}
+	}
+}
+
+func TestEgress_CountryMismatches(t *testing.T) {
+	tests := []struct {
+		configured string
+		egress     egress
+	}{
+		{"US", egress{Country: "Russia", CountryCode: "RU"}},
+		{"UK", egress{Country: "Ukraine", CountryCode: "UA"}},
+		{"DE", egress{Country: "Bangladesh", CountryCode: "BD"}},
+		{"Korea", egress{Country: "North Korea", CountryCode: "KP"}},
+		{"Guinea", egress{Country: "Papua New Guinea", CountryCode: "PG"}},
+		{"US", egress{Country: "Russia"}},
+		{"Korea", egress{Country: "North Korea"}},
+	}
+
+	for _, tt := range tests {
+		if tt.egress.countryMatches(tt.configured) {
+			t.Errorf("expected %q not to match %q (%s)", tt.configured, tt.egress.Country, tt.egress.CountryCode)
+		}
+	}
+}
+
+func TestEgress_CountryAliases(t *testing.T) {
+	tests := []struct {
+		configured string
+		egress     egress
+	}{
+		{"UK", egress{Country: "United Kingdom", CountryCode: "GB"}},
+		{"United Kingdom", egress{CountryCode: "GB"}},
+		{"USA", egress{Country: "United States"}},
+		{"Guinea", egress{Country: "Guinea", CountryCode: "GN"}},
+		{"kr", egress{Country: "KR"}},
+	}
+
+	for _, tt := range tests {
+		if !tt.egress.countryMatches(tt.configured) {
+			t.Errorf("expected %q to match %q (%s)", tt.configured, tt.egress.Country, tt.egress.CountryCode)
+		}
+	}
+}
+
+// newEgressTestProvider returns a provider whose exits proxy through echo and
+// which uses echo as its IP echo service.
+func newEgressTestProvider(t *testing.T, d *fakeDocker, echo *httptest.Server) *GluetunProvider {
+	t.Helper()
+
+	p := newTestGluetunProvider(t, d, WithIPEchoURL(echo.URL+"/json"))
+	echoURL, _ := url.Parse(echo.URL)
+	p.proxyAddr = func(string) string { return echoURL.Host }
+	return p
+}
+
+func TestGluetunProvider_RecordsEgress(t *testing.T) {
+	d := newFakeDocker(t)
+	echo := newEchoServer(t, `{"ip":"203.0.113.7","country":"South Korea","country_iso":"KR"}`)
+	p := newEgressTestProvider(t, d, echo)
+
+	exit := testGluetunExit("Korea")
+	exit.VerifyCountry = true
+
+	h, err := p.GetHandler(context.Background(), "kr", exit)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	status, _ := p.ExitStatus(context.Background(), "kr", exit)
+	if status.EgressIP != "203.0.113.7" || status.EgressCountry != "South Korea" {
+		t.Errorf("unexpected egress in status: %+v", status)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+	if got := w.Header().Get(HeaderExitIP); got != "203.0.113.7" {
+		t.Errorf("expected %s header '203.0.113.7', got '%s'", HeaderExitIP, got)
+	}
+	if got := w.Header().Get(HeaderExitCountry); got != "South Korea" {
+		t.Errorf("expected %s header 'South Korea', got '%s'", HeaderExitCountry, got)
+	}
+}
+
+func TestGluetunProvider_RefusesCountryMismatch(t *testing.T) {
+	d := newFakeDocker(t)
+	echo := newEchoServer(t, `{"ip":"203.0.113.7","country":"Japan","country_iso":"JP"}`)
+	p := newEgressTestProvider(t, d, echo)
+
+	exit := testGluetunExit("Korea")
+	exit.VerifyCountry = true
+
+	if _, err := p.GetHandler(context.Background(), "kr", exit); err == nil {
+		t.Fatal("expected error for egress in the wrong country, got nil")
+	}
+
+	if c := d.container("gluetun-kr"); c != nil {
+		t.Errorf("expected container to be stopped, got %+v", c)
+	}
+}
+
+func TestGluetunProvider_MismatchAllowedWithoutVerification(t *testing.T) {
+	d := newFakeDocker(t)
+	echo := newEchoServer(t, `{"ip":"203.0.113.7","country":"Japan","country_iso":"JP"}`)
+	p := newEgressTestProvider(t, d, echo)
+
+	if _, err := p.GetHandler(context.Background(), "kr", testGluetunExit("Korea")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
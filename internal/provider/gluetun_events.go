@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// watchEvents follows the Docker events stream so that containers which die,
+// are removed or change health outside GeoSwitch are noticed straight away
+// rather than at the next health poll. The stream is reopened with backoff if
+// it fails; events missed in between are caught up by the health monitor.
+// It runs until the provider is closed.
+func (p *GluetunProvider) watchEvents() {
+	defer p.background.Done()
+
+	backoff := time.Second
+	for {
+		msgs, errs := p.docker.Events(p.ctx, events.ListOptions{
+			Filters: filters.NewArgs(
+				filters.Arg("type", string(events.ContainerEventType)),
+				filters.Arg("event", string(events.ActionDie)),
+				filters.Arg("event", string(events.ActionDestroy)),
+				filters.Arg("event", string(events.ActionHealthStatus)),
+			),
+		})
+
+		err := p.consumeEvents(msgs, errs, &backoff)
+		if p.ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("[gluetun] docker events stream failed, reconnecting in %s: %v", backoff, err)
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+// consumeEvents handles events until the stream fails, resetting backoff once
+// the stream is delivering again.
+func (p *GluetunProvider) consumeEvents(msgs <-chan events.Message, errs <-chan error, backoff *time.Duration) error {
+	for {
+		select {
+		case msg := <-msgs:
+			*backoff = time.Second
+			p.handleEvent(msg)
+		case err := <-errs:
+			return err
+		}
+	}
+}
+
+// handleEvent applies a container event to the runtime owning the container, if any.
+func (p *GluetunProvider) handleEvent(msg events.Message) {
+	exitName, rt := p.runtimeByContainer(msg.Actor.ID)
+	if rt == nil {
+		return // not one of ours, or already stopped
+	}
+
+	switch {
+	case msg.Action == events.ActionDie || msg.Action == events.ActionDestroy:
+		log.Printf("[gluetun] container '%s' for exit '%s' stopped unexpectedly (%s)", rt.containerName, exitName, msg.Action)
+		rt.setHealth(healthMissing)
+		// The next request for the exit starts a fresh container
+		if p.invalidate(exitName, rt) {
+			p.restartIfEager(exitName, rt)
+		}
+
+	case msg.Action == events.ActionHealthStatusHealthy || msg.Action == events.ActionHealthStatusUnhealthy:
+		// Recovery of unhealthy exits is left to the health monitor, which
+		// gives the container a few checks to come back first
+		_, health, _ := strings.Cut(string(msg.Action), ": ")
+		rt.setHealth(health)
+	}
+}
+
+// runtimeByContainer finds the runtime running containerID.
+func (p *GluetunProvider) runtimeByContainer(containerID string) (string, *exitRuntime) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for exitName, rt := range p.runtimes {
+		if rt.containerID == containerID {
+			return exitName, rt
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,169 @@
+package provider
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/docker/docker/errdefs"
+)
+
+// Cached health states of a runtime. Besides the Docker healthcheck states
+// ("starting", "healthy", "unhealthy"), containers without a healthcheck report
+// their container state ("running", "exited", ...) and removed ones "missing".
+const (
+	healthHealthy  = "healthy"
+	healthStarting = "starting"
+	healthRunning  = "running"
+	healthMissing  = "missing"
+)
+
+// unhealthyThreshold is the number of consecutive unhealthy checks after which
+// the monitor replaces a runtime's container.
+const unhealthyThreshold = 3
+
+// available reports whether the runtime's last known health allows serving requests.
+func (rt *exitRuntime) available() bool {
+	health := rt.healthStatus()
+	return health == healthHealthy || health == healthRunning
+}
+
+func (rt *exitRuntime) healthStatus() string {
+	health, _ := rt.health.Load().(string)
+	return health
+}
+
+func (rt *exitRuntime) setHealth(health string) {
+	if old := rt.healthStatus(); old != health {
+		log.Printf("[gluetun] container '%s' health changed: %s -> %s", rt.containerName, old, health)
+	}
+	rt.health.Store(health)
+}
+
+// monitorHealth periodically inspects every running container and updates the
+// cached health of its runtime, so requests never wait on the Docker API. On
+// the same schedule it stops exits that have been idle for too long.
+// It runs until the provider is closed.
+func (p *GluetunProvider) monitorHealth(interval time.Duration) {
+	defer p.background.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.checkHealth()
+			p.reapIdle(now)
+		}
+	}
+}
+
+// checkHealth refreshes the cached health of all runtimes, starting recovery
+// of those that are gone or have been unhealthy for too long.
+func (p *GluetunProvider) checkHealth() {
+	p.mu.Lock()
+	runtimes := make(map[string]*exitRuntime, len(p.runtimes))
+	for name, rt := range p.runtimes {
+		runtimes[name] = rt
+	}
+	p.mu.Unlock()
+
+	for exitName, rt := range runtimes {
+		ctx, cancel := context.WithTimeout(p.ctx, 5*time.Second)
+		inspect, err := p.docker.ContainerInspect(ctx, rt.containerID)
+		cancel()
+
+		switch {
+		case errdefs.IsNotFound(err):
+			rt.setHealth(healthMissing)
+			log.Printf("[gluetun] container '%s' for exit '%s' no longer exists", rt.containerName, exitName)
+			if p.invalidate(exitName, rt) {
+				p.restartIfEager(exitName, rt)
+			}
+			continue
+		case err != nil:
+			// Keep the last known state; the Docker API may be briefly unavailable
+			log.Printf("[gluetun] health check of container '%s' failed: %v", rt.containerName, err)
+			continue
+		case inspect.State != nil && inspect.State.Health != nil:
+			rt.setHealth(inspect.State.Health.Status)
+		case inspect.State != nil:
+			rt.setHealth(inspect.State.Status)
+		}
+
+		if rt.available() {
+			rt.failures = 0
+			continue
+		}
+		if rt.healthStatus() == healthStarting {
+			continue // still within its start period, e.g. an adopted container
+		}
+
+		rt.failures++
+		if rt.failures >= unhealthyThreshold {
+			log.Printf("[gluetun] exit '%s' unhealthy for %d checks, recovering", exitName, rt.failures)
+			rt.failures = 0
+			p.background.Add(1)
+			go p.recoverExit(exitName, rt)
+		}
+	}
+}
+
+// invalidate drops rt from the cache if it is still the runtime of exitName,
+// so the next request starts a fresh container. It reports whether rt was dropped.
+func (p *GluetunProvider) invalidate(exitName string, rt *exitRuntime) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.runtimes[exitName] != rt {
+		return false
+	}
+
+	delete(p.runtimes, exitName)
+	if rt.cancelLogs != nil {
+		rt.cancelLogs()
+	}
+	log.Printf("[gluetun] invalidated runtime for exit '%s'", exitName)
+	return true
+}
+
+// restartIfEager starts a fresh container in the background for an invalidated
+// runtime of an eager exit, which is kept running rather than started on the
+// next request. rt must no longer be in p.runtimes.
+func (p *GluetunProvider) restartIfEager(exitName string, rt *exitRuntime) {
+	if !rt.cfg.Eager {
+		return
+	}
+
+	log.Printf("[gluetun] restarting eager exit '%s'", exitName)
+	p.background.Add(1)
+	go func() {
+		defer p.background.Done()
+		if _, err := p.ensureRuntime(p.ctx, exitName, rt.cfg); err != nil {
+			log.Printf("[gluetun] failed to restart eager exit '%s': %v", exitName, err)
+		}
+	}()
+}
+
+// recoverExit replaces the container of an unhealthy runtime with a new one.
+func (p *GluetunProvider) recoverExit(exitName string, rt *exitRuntime) {
+	defer p.background.Done()
+
+	if !p.invalidate(exitName, rt) {
+		return // already stopped or replaced
+	}
+
+	// The runtime is no longer in p.runtimes, so stop it even if Close has begun
+	if err := p.stopRuntime(context.Background(), exitName, rt); err != nil {
+		log.Printf("[gluetun] failed to stop unhealthy container '%s': %v", rt.containerName, err)
+	}
+
+	if _, err := p.ensureRuntime(p.ctx, exitName, rt.cfg); err != nil {
+		log.Printf("[gluetun] failed to recover exit '%s': %v", exitName, err)
+		return
+	}
+	log.Printf("[gluetun] recovered exit '%s'", exitName)
+}
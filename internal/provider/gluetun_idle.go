@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// idleSince returns when the runtime last finished serving a request, or when
+// it was created if it has not served any yet.
+func (rt *exitRuntime) idleSince() time.Time {
+	if lastUsed := rt.lastUsed.Load(); lastUsed > 0 {
+		return time.Unix(0, lastUsed)
+	}
+	return rt.created
+}
+
+// reapIdle stops the containers of exits that have served no requests for
+// longer than their idle_timeout. The next request for a reaped exit starts it
+// again through the usual cold-start path.
+func (p *GluetunProvider) reapIdle(now time.Time) {
+	p.mu.Lock()
+	idle := make(map[string]*exitRuntime)
+	for exitName, rt := range p.runtimes {
+		if rt.idle(now) {
+			// Removing the runtime under the lock means no new request can pick it up
+			delete(p.runtimes, exitName)
+			idle[exitName] = rt
+		}
+	}
+	p.mu.Unlock()
+
+	for exitName, rt := range idle {
+		log.Printf("[gluetun] exit '%s' idle since %s, stopping it", exitName, rt.idleSince().Format(time.RFC3339))
+		p.background.Add(1)
+		go p.reapExit(exitName, rt)
+	}
+}
+
+// idle reports whether the runtime has exceeded its idle timeout at now.
+func (rt *exitRuntime) idle(now time.Time) bool {
+	timeout := rt.cfg.IdleTimeout
+	return !rt.cfg.Eager && timeout > 0 && rt.active.Load() == 0 && now.Sub(rt.idleSince()) >= timeout
+}
+
+// reapExit stops an idle runtime, letting any request that raced the reaper finish first.
+func (p *GluetunProvider) reapExit(exitName string, rt *exitRuntime) {
+	defer p.background.Done()
+
+	// Not bound to p.ctx: the runtime is no longer in p.runtimes, so Close
+	// would not stop the container if this were aborted
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	err := rt.drain(ctx)
+	cancel()
+	if err != nil {
+		log.Printf("[gluetun] exit '%s' did not drain in time, stopping anyway", exitName)
+	}
+
+	// The stop gets its own context, as draining may have used up the last one
+	if err := p.stopRuntime(context.Background(), exitName, rt); err != nil {
+		log.Printf("[gluetun] failed to stop idle exit '%s': %v", exitName, err)
+	}
+}
@@ -0,0 +1,220 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+
+	"geoswitch/internal/config"
+)
+
+// Pool health states, reported for pool exits in ExitStatus.Health.
+const (
+	poolHealthy   = "healthy"   // all members serving
+	poolDegraded  = "degraded"  // some members serving
+	poolUnhealthy = "unhealthy" // no member serving
+)
+
+// pool spreads the requests of a pool exit over its members. Each member is
+// an ordinary runtime keyed by its member name, so health monitoring, events,
+// recovery and idle reaping apply to members individually.
+type pool struct {
+	exitName string
+	cfg      config.ExitConfig
+	members  []config.PoolMember
+	handler  http.Handler
+
+	next atomic.Uint64 // round-robin position
+}
+
+// poolFor returns the pool of exitName, creating it or replacing it if cfg changed.
+func (p *GluetunProvider) poolFor(exitName string, cfg config.ExitConfig) *pool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pl, ok := p.pools[exitName]; ok && reflect.DeepEqual(pl.cfg, cfg) {
+		return pl
+	}
+
+	pl := &pool{
+		exitName: exitName,
+		cfg:      cfg,
+		members:  cfg.PoolMembers(exitName),
+	}
+	pl.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.servePool(w, r, pl)
+	})
+	p.pools[exitName] = pl
+	return pl
+}
+
+// poolHandler returns the handler of a pool exit. If no member is serving yet,
+// it waits for all members to start and succeeds once at least one has.
+func (p *GluetunProvider) poolHandler(ctx context.Context, exitName string, cfg config.ExitConfig) (http.Handler, error) {
+	pl := p.poolFor(exitName, cfg)
+
+	if len(p.poolMembers(pl)) > 0 {
+		return pl.handler, nil
+	}
+
+	started, err := p.startPool(ctx, pl, len(pl.members))
+	if started == 0 {
+		return nil, fmt.Errorf("exit '%s': no pool member started: %w", exitName, err)
+	}
+	if len(p.poolMembers(pl)) == 0 {
+		return nil, fmt.Errorf("exit '%s' has no healthy members", exitName)
+	}
+	return pl.handler, nil
+}
+
+// startPool starts all members of pl in parallel and waits until required of
+// them are running, or until too many have failed for that to happen. It
+// returns how many members are running and the errors of those that failed.
+// Members still starting when it returns carry on in the background.
+func (p *GluetunProvider) startPool(ctx context.Context, pl *pool, required int) (int, error) {
+	results := make(chan error, len(pl.members))
+	for _, member := range pl.members {
+		go func() {
+			_, err := p.ensureRuntime(ctx, member.Name, member.Exit)
+			results <- err
+		}()
+	}
+
+	started, failed := 0, 0
+	var errs []error
+	for started < required && len(pl.members)-failed >= required {
+		if err := <-results; err != nil {
+			failed++
+			errs = append(errs, err)
+		} else {
+			started++
+		}
+	}
+	return started, errors.Join(errs...)
+}
+
+// poolMembers returns the runtimes of pl that can serve requests. Members
+// with neither a runtime nor a startup in progress, e.g. after being reaped
+// or having crashed, are started again in the background.
+func (p *GluetunProvider) poolMembers(pl *pool) []*exitRuntime {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.poolMembersLocked(pl)
+}
+
+// poolMembersLocked is poolMembers for callers that hold p.mu.
+func (p *GluetunProvider) poolMembersLocked(pl *pool) []*exitRuntime {
+	available := make([]*exitRuntime, 0, len(pl.members))
+	var missing []config.PoolMember
+	for _, member := range pl.members {
+		rt, ok := p.runtimes[member.Name]
+		if ok {
+			if rt.available() {
+				available = append(available, rt)
+			}
+			continue
+		}
+		if _, starting := p.starting[member.Name]; !starting {
+			missing = append(missing, member)
+		}
+	}
+
+	// A cold pool is started by poolHandler instead, which waits for it
+	if len(available) > 0 {
+		for _, member := range missing {
+			log.Printf("[gluetun] restarting member '%s' of pool '%s'", member.Name, pl.exitName)
+			p.beginStartup(member.Name, member.Exit)
+		}
+	}
+	return available
+}
+
+// servePool proxies a request through one of the pool's serving members.
+func (p *GluetunProvider) servePool(w http.ResponseWriter, r *http.Request, pl *pool) {
+	// The member is picked and marked as used under the lock, so the reaper
+	// cannot stop it before the request starts
+	p.mu.Lock()
+	var rt *exitRuntime
+	if members := p.poolMembersLocked(pl); len(members) > 0 {
+		rt = pl.pick(members, sessionFrom(r.Context()))
+		rt.touch()
+	}
+	p.mu.Unlock()
+
+	if rt == nil {
+		http.Error(w, fmt.Sprintf("exit '%s' has no healthy members", pl.exitName), http.StatusServiceUnavailable)
+		return
+	}
+	rt.handler.ServeHTTP(w, r)
+}
+
+// pick chooses the member to serve the next request according to the pool's
+// balancing strategy. Requests of a session all go to the same member, for as
+// long as the set of available members does not change.
+func (pl *pool) pick(members []*exitRuntime, session string) *exitRuntime {
+	if session != "" {
+		h := fnv.New32a()
+		h.Write([]byte(session))
+		return members[h.Sum32()%uint32(len(members))]
+	}
+
+	start := int(pl.next.Add(1) % uint64(len(members)))
+	if pl.cfg.Balance != config.BalanceLeastConn {
+		return members[start]
+	}
+
+	// Least connections, breaking ties round-robin so idle members share the load
+	best := members[start]
+	for i := 1; i < len(members); i++ {
+		rt := members[(start+i)%len(members)]
+		if rt.active.Load() < best.active.Load() {
+			best = rt
+		}
+	}
+	return best
+}
+
+// poolStatus aggregates the status of the members of a pool exit.
+func (p *GluetunProvider) poolStatus(exitName string, cfg config.ExitConfig) ExitStatus {
+	status := ExitStatus{
+		State:   StateStopped,
+		Members: make(map[string]ExitStatus),
+	}
+
+	serving := 0
+	for _, member := range cfg.PoolMembers(exitName) {
+		ms := p.runtimeStatus(member.Name)
+		status.Members[member.Name] = ms
+
+		switch {
+		case ms.State == StateRunning:
+			status.State = StateRunning
+		case ms.State == StateStarting && status.State == StateStopped:
+			status.State = StateStarting
+		}
+
+		if ms.State == StateRunning && (ms.Health == healthHealthy || ms.Health == healthRunning) {
+			serving++
+		}
+		if ms.LastUsedAt.After(status.LastUsedAt) {
+			status.LastUsedAt = ms.LastUsedAt
+		}
+	}
+
+	if status.State == StateRunning {
+		switch serving {
+		case len(status.Members):
+			status.Health = poolHealthy
+		case 0:
+			status.Health = poolUnhealthy
+		default:
+			status.Health = poolDegraded
+		}
+	}
+	return status
+}
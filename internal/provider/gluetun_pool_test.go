@@ -0,0 +1,229 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"geoswitch/internal/config"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+// newPoolTestProvider returns a provider whose containers all proxy through a
+// stub server, so pool handlers can serve requests in tests.
+func newPoolTestProvider(t *testing.T, d *fakeDocker) *GluetunProvider {
+	t.Helper()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(upstream.Close)
+
+	p := newTestGluetunProvider(t, d)
+	p.proxyAddr = func(string) string { return upstream.Listener.Addr().String() }
+	return p
+}
+
+func testPoolExit(replicas int) config.ExitConfig {
+	exit := testGluetunExit("Korea")
+	exit.Replicas = replicas
+	return exit
+}
+
+// memberRuntime returns the runtime of a pool member, or nil.
+func memberRuntime(p *GluetunProvider, name string) *exitRuntime {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.runtimes[name]
+}
+
+func TestGluetunProvider_PoolStartsAllMembers(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newPoolTestProvider(t, d)
+
+	exit := testPoolExit(3)
+	if _, err := p.GetHandler(context.Background(), "kr", exit); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, name := range []string{"gluetun-kr-1", "gluetun-kr-2", "gluetun-kr-3"} {
+		if d.container(name) == nil {
+			t.Errorf("expected container '%s' to be created", name)
+		}
+	}
+
+	status, _ := p.ExitStatus(context.Background(), "kr", exit)
+	if status.State != StateRunning || status.Health != poolHealthy || len(status.Members) != 3 {
+		t.Errorf("unexpected pool status: %+v", status)
+	}
+
+	if err := p.StopExit(context.Background(), "kr"); err != nil {
+		t.Fatalf("unexpected error stopping pool: %v", err)
+	}
+	for _, name := range []string{"gluetun-kr-1", "gluetun-kr-2", "gluetun-kr-3"} {
+		if d.container(name) != nil {
+			t.Errorf("expected container '%s' to be stopped", name)
+		}
+	}
+}
+
+func TestGluetunProvider_StartExitPoolMinReady(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newPoolTestProvider(t, d)
+
+	// Keep the third member starting while the others are up
+	release := d.blockCreate("gluetun-kr-3")
+	t.Cleanup(release)
+
+	exit := testPoolExit(3)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if err := p.StartExit(ctx, "kr", exit); err == nil {
+		t.Fatal("expected error while not all members have started, got nil")
+	}
+
+	// Without a deadline, as for warm-ups, the start must not wait for the third member
+	exit.MinReady = 2
+	done := make(chan error, 1)
+	go func() { done <- p.StartExit(context.Background(), "kr", exit) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected pool with 2 of 3 members to satisfy min_ready, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected start to return once min_ready members were running")
+	}
+}
+
+func TestGluetunProvider_PoolRoundRobin(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newPoolTestProvider(t, d)
+
+	h, err := p.GetHandler(context.Background(), "kr", testPoolExit(3))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for range 3 {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	}
+
+	for _, name := range []string{"kr-1", "kr-2", "kr-3"} {
+		if memberRuntime(p, name).lastUsed.Load() == 0 {
+			t.Errorf("expected member '%s' to serve a request", name)
+		}
+	}
+}
+
+func TestGluetunProvider_PoolSkipsUnhealthyMembers(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newPoolTestProvider(t, d)
+
+	exit := testPoolExit(3)
+	h, err := p.GetHandler(context.Background(), "kr", exit)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	unhealthy := memberRuntime(p, "kr-2")
+	d.emit(unhealthy.containerID, events.ActionHealthStatusUnhealthy)
+	waitFor(t, func() bool { return !unhealthy.available() })
+
+	for range 6 {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+	}
+
+	if unhealthy.lastUsed.Load() != 0 {
+		t.Error("expected unhealthy member to be taken out of rotation")
+	}
+
+	if status, _ := p.ExitStatus(context.Background(), "kr", exit); status.Health != poolDegraded {
+		t.Errorf("expected pool health '%s', got '%s'", poolDegraded, status.Health)
+	}
+}
+
+func TestPool_PickLeastConn(t *testing.T) {
+	pl := &pool{cfg: config.ExitConfig{Balance: config.BalanceLeastConn}}
+
+	busy, idle := &exitRuntime{}, &exitRuntime{}
+	busy.active.Store(3)
+
+	for range 4 {
+		if got := pl.pick([]*exitRuntime{busy, idle}, ""); got != idle {
+			t.Fatal("expected least-connections to pick the idle member")
+		}
+	}
+}
+
+func TestPool_PickSession(t *testing.T) {
+	pl := &pool{}
+	members := []*exitRuntime{{}, {}, {}}
+
+	first := pl.pick(members, "42")
+	for range 6 {
+		if got := pl.pick(members, "42"); got != first {
+			t.Fatal("expected requests of a session to stay on the same member")
+		}
+	}
+}
+
+func TestGluetunProvider_ReconcileAdoptsPoolMembers(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newTestGluetunProvider(t, d)
+
+	exit := testPoolExit(2)
+	cfg := &config.Config{DefaultExit: "kr", Exits: map[string]config.ExitConfig{"kr": exit}}
+
+	members := exit.PoolMembers("kr")
+	kept := d.addContainer("gluetun-kr-1", p.labels(members[0].Name, members[0].Exit))
+	removed := d.addContainer("gluetun-kr-3", p.labels("kr-3", members[0].Exit))
+
+	if err := p.Reconcile(context.Background(), cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if d.container(kept.ID) == nil {
+		t.Error("expected container of pool member 'kr-1' to be adopted")
+	}
+	if d.container(removed.ID) != nil {
+		t.Error("expected container of removed pool member 'kr-3' to be removed")
+	}
+}
+
+func TestGluetunProvider_StopExitStopsAdoptedPoolMembers(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newPoolTestProvider(t, d)
+
+	exit := testPoolExit(2)
+	cfg := &config.Config{DefaultExit: "kr", Exits: map[string]config.ExitConfig{"kr": exit}}
+
+	var adopted []*fakeContainer
+	for _, member := range exit.PoolMembers("kr") {
+		adopted = append(adopted, d.addContainer(containerNameFor(member.Name), p.labels(member.Name, member.Exit)))
+	}
+
+	if err := p.Reconcile(context.Background(), cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The pool has not served a request, so only the adopted runtimes know of it
+	if err := p.StopExit(context.Background(), "kr"); err != nil {
+		t.Fatalf("unexpected error stopping pool: %v", err)
+	}
+
+	for _, c := range adopted {
+		if d.container(c.ID) != nil {
+			t.Errorf("expected adopted container '%s' to be stopped", c.Name)
+		}
+	}
+	if rt := memberRuntime(p, "kr-1"); rt != nil {
+		t.Error("expected runtime of adopted member 'kr-1' to be removed")
+	}
+}
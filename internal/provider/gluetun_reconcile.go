@@ -0,0 +1,171 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"geoswitch/internal/config"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// Labels put on every container the provider creates.
+const (
+	labelOwner      = "geoswitch.owner"       // owner ID of the GeoSwitch instance
+	labelExit       = "geoswitch.exit"        // exit, or pool member, the container serves
+	labelConfigHash = "geoswitch.config-hash" // configHash of the image and exit settings
+)
+
+// containerNameFor returns the name of the Gluetun container of an exit.
+func containerNameFor(exitName string) string {
+	return "gluetun-" + exitName
+}
+
+// configHash identifies everything a container was created from, so a
+// container can be reused only while the image and exit settings are unchanged.
+func (p *GluetunProvider) configHash(cfg config.ExitConfig) string {
+	h := sha256.New()
+	fmt.Fprintln(h, p.image)
+	for _, kv := range gluetunEnv(cfg) {
+		fmt.Fprintln(h, kv)
+	}
+
+	// Credentials are not in the environment, but changing them still needs a new container
+	secrets := gluetunSecrets(cfg)
+	paths := make([]string, 0, len(secrets))
+	for path := range secrets {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintln(h, path, secrets[path])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (p *GluetunProvider) labels(exitName string, cfg config.ExitConfig) map[string]string {
+	return map[string]string{
+		labelOwner:      p.owner,
+		labelExit:       exitName,
+		labelConfigHash: p.configHash(cfg),
+	}
+}
+
+// matches reports whether a container with the given labels was created by
+// this provider for exitName with the current settings.
+func (p *GluetunProvider) matches(labels map[string]string, exitName string, cfg config.ExitConfig) bool {
+	return labels[labelOwner] == p.owner &&
+		labels[labelExit] == exitName &&
+		labels[labelConfigHash] == p.configHash(cfg)
+}
+
+// removeContainer force-removes a container, stopping it if it is running.
+func (p *GluetunProvider) removeContainer(ctx context.Context, containerID string) error {
+	err := p.docker.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true})
+	if err != nil {
+		log.Printf("[gluetun] failed to remove container '%s': %v", containerID, err)
+	}
+	return err
+}
+
+// Reconcile brings the containers left behind by a previous run in line with
+// cfg. It should be called once at startup, before serving requests. Of the
+// containers labelled with this provider's owner ID:
+//
+//   - running containers whose exit is configured with the same settings are
+//     adopted and serve requests straight away, unless their egress fails
+//     verification, in which case they are removed
+//   - containers whose exit settings or image changed are removed, to be
+//     recreated on the next request
+//   - containers whose exit is no longer configured, or no longer uses
+//     Gluetun, are removed
+func (p *GluetunProvider) Reconcile(ctx context.Context, cfg *config.Config) error {
+	containers, err := p.docker.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", labelOwner+"="+p.owner)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	log.Printf("[gluetun] reconciling %d existing containers", len(containers))
+
+	// Containers are labelled with the name of their exit, or of their pool member
+	wanted := make(map[string]config.ExitConfig)
+	for name, exit := range cfg.Exits {
+		if exit.Provider != config.ProviderGluetun {
+			continue
+		}
+		if !exit.IsPool() {
+			wanted[name] = exit
+			continue
+		}
+		for _, member := range exit.PoolMembers(name) {
+			wanted[member.Name] = member.Exit
+		}
+	}
+
+	var errs []string
+	for _, c := range containers {
+		exitName := c.Labels[labelExit]
+		exit, ok := wanted[exitName]
+
+		switch {
+		case !ok:
+			log.Printf("[gluetun] removing orphaned container %s for exit '%s'", c.ID, exitName)
+		case !p.matches(c.Labels, exitName, exit):
+			log.Printf("[gluetun] removing container %s for exit '%s' with stale settings", c.ID, exitName)
+		case c.State != container.StateRunning:
+			log.Printf("[gluetun] removing container %s for exit '%s' in state '%s'", c.ID, exitName, c.State)
+		default:
+			err := p.adopt(ctx, exitName, c.ID, exit)
+			if err == nil {
+				continue
+			}
+			log.Printf("[gluetun] not adopting container %s: %v", c.ID, err)
+		}
+
+		if err := p.removeContainer(ctx, c.ID); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to remove containers: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// adopt registers a running container from a previous run as the runtime of exitName.
+func (p *GluetunProvider) adopt(ctx context.Context, exitName, containerID string, cfg config.ExitConfig) error {
+	rt := p.newRuntime(containerID, containerNameFor(exitName), cfg)
+
+	inspect, err := p.docker.ContainerInspect(ctx, containerID)
+	switch {
+	case err != nil:
+		// Leave health unset; the monitor fills it in on its next check
+		log.Printf("[gluetun] failed to inspect adopted container '%s': %v", rt.containerName, err)
+	case inspect.State != nil && inspect.State.Health != nil:
+		rt.health.Store(inspect.State.Health.Status)
+	case inspect.State != nil:
+		rt.health.Store(inspect.State.Status)
+	}
+
+	if err := p.verifyEgress(ctx, exitName, rt, cfg); err != nil {
+		rt.cancelLogs()
+		return err
+	}
+
+	p.mu.Lock()
+	p.runtimes[exitName] = rt
+	p.mu.Unlock()
+
+	log.Printf("[gluetun] adopted container '%s' for exit '%s' (health=%s)", rt.containerName, exitName, rt.healthStatus())
+	return nil
+}
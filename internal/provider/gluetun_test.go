@@ -0,0 +1,664 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"geoswitch/internal/config"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+func TestGluetunEnv_OpenVPN(t *testing.T) {
+	env := gluetunEnv(config.ExitConfig{
+		Provider: "gluetun",
+		Country:  "Korea",
+		Gluetun: &config.GluetunSettings{
+			ServiceProvider: "nordvpn",
+			OpenVPNUser:     "user",
+			OpenVPNPassword: "pass",
+			ServerCities:    []string{"Seoul", "Busan"},
+			Env:             map[string]string{"B": "2", "A": "1"},
+		},
+	})
+
+	expected := []string{
+		"HTTPPROXY=on",
+		"SERVER_COUNTRIES=Korea",
+		"VPN_SERVICE_PROVIDER=nordvpn",
+		"VPN_TYPE=openvpn",
+		"OPENVPN_USER=user",
+		"OPENVPN_PASSWORD_SECRETFILE=/run/secrets/openvpn_password",
+		"SERVER_CITIES=Seoul,Busan",
+		"A=1",
+		"B=2",
+	}
+
+	if !slices.Equal(env, expected) {
+		t.Errorf("expected env %v, got %v", expected, env)
+	}
+}
+
+func TestGluetunEnv_Wireguard(t *testing.T) {
+	env := gluetunEnv(config.ExitConfig{
+		Provider: "gluetun",
+		Country:  "Sweden",
+		Gluetun: &config.GluetunSettings{
+			ServiceProvider:     "mullvad",
+			VPNType:             "wireguard",
+			WireguardPrivateKey: "key",
+			WireguardAddresses:  "10.64.0.1/32",
+			ServerHostnames:     []string{"se-sto-wg-001"},
+		},
+	})
+
+	for _, want := range []string{
+		"VPN_TYPE=wireguard",
+		"WIREGUARD_PRIVATE_KEY_SECRETFILE=/run/secrets/wireguard_private_key",
+		"WIREGUARD_ADDRESSES=10.64.0.1/32",
+		"SERVER_HOSTNAMES=se-sto-wg-001",
+	} {
+		if !slices.Contains(env, want) {
+			t.Errorf("expected env to contain '%s', got %v", want, env)
+		}
+	}
+
+	for _, v := range env {
+		if len(v) >= 8 && v[:8] == "OPENVPN_" {
+			t.Errorf("expected no OpenVPN variables for wireguard, got '%s'", v)
+		}
+	}
+}
+
+func testGluetunExit(country string) config.ExitConfig {
+	return config.ExitConfig{
+		Provider: "gluetun",
+		Country:  country,
+		Gluetun: &config.GluetunSettings{
+			ServiceProvider: "nordvpn",
+			OpenVPNUser:     "user",
+			OpenVPNPassword: "pass",
+		},
+	}
+}
+
+func TestGluetunProvider_CreatesContainerFromExitSettings(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newTestGluetunProvider(t, d)
+
+	if _, err := p.GetHandler(context.Background(), "kr", testGluetunExit("Korea")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c := d.container("gluetun-kr")
+	if c == nil {
+		t.Fatal("expected container 'gluetun-kr' to be created")
+	}
+
+	if got := envValue(c.Env, "SERVER_COUNTRIES"); got != "Korea" {
+		t.Errorf("expected SERVER_COUNTRIES 'Korea', got '%s'", got)
+	}
+	if got := envValue(c.Env, "OPENVPN_USER"); got != "user" {
+		t.Errorf("expected OPENVPN_USER 'user', got '%s'", got)
+	}
+}
+
+func TestGluetunProvider_CopiesCredentialsAsFiles(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newTestGluetunProvider(t, d)
+
+	exit := testGluetunExit("Korea")
+	exit.Gluetun.OpenVPNPassword = "s3cret-value"
+	if _, err := p.GetHandler(context.Background(), "kr", exit); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c := d.container("gluetun-kr")
+	for _, kv := range c.Env {
+		if strings.Contains(kv, "s3cret-value") {
+			t.Errorf("expected no credentials in the environment, got '%s'", kv)
+		}
+	}
+	if got := c.Files["/run/secrets/openvpn_password"]; got != "s3cret-value" {
+		t.Errorf("expected password file 's3cret-value', got '%s'", got)
+	}
+
+	// A new password needs a new container even though the environment is unchanged
+	rotated := testGluetunExit("Korea")
+	if p.configHash(rotated) == p.configHash(exit) {
+		t.Error("expected a changed password to change the config hash")
+	}
+}
+
+func TestGluetunProvider_ConcurrentRequestsShareStartup(t *testing.T) {
+	d := newFakeDocker(t)
+	release := d.blockCreate("gluetun-kr")
+	defer release()
+
+	p := newTestGluetunProvider(t, d)
+
+	const callers = 5
+	var wg sync.WaitGroup
+	handlers := make([]http.Handler, callers)
+	errs := make([]error, callers)
+
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handlers[i], errs[i] = p.GetHandler(context.Background(), "kr", testGluetunExit("Korea"))
+		}()
+	}
+
+	<-d.createStarted
+	release()
+	wg.Wait()
+
+	for i := range callers {
+		if errs[i] != nil {
+			t.Fatalf("caller %d: unexpected error: %v", i, errs[i])
+		}
+		if handlers[i] == nil {
+			t.Errorf("caller %d: expected a handler", i)
+		}
+	}
+
+	if n := d.createCount(); n != 1 {
+		t.Errorf("expected 1 container to be created, got %d", n)
+	}
+}
+
+func TestGluetunProvider_ColdExitDoesNotBlockOtherExits(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newTestGluetunProvider(t, d)
+
+	if _, err := p.GetHandler(context.Background(), "uk", testGluetunExit("United Kingdom")); err != nil {
+		t.Fatalf("unexpected error warming 'uk': %v", err)
+	}
+	<-d.createStarted
+
+	release := d.blockCreate("gluetun-kr")
+	defer release()
+
+	coldDone := make(chan error, 1)
+	go func() {
+		_, err := p.GetHandler(context.Background(), "kr", testGluetunExit("Korea"))
+		coldDone <- err
+	}()
+	<-d.createStarted
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if _, err := p.GetHandler(ctx, "uk", testGluetunExit("United Kingdom")); err != nil {
+		t.Fatalf("expected warm exit to be served during cold startup, got: %v", err)
+	}
+
+	if status, _ := p.ExitStatus(ctx, "kr", testGluetunExit("Korea")); status.State != StateStarting {
+		t.Errorf("expected 'kr' to be starting, got '%s'", status.State)
+	}
+
+	release()
+	if err := <-coldDone; err != nil {
+		t.Fatalf("unexpected error starting 'kr': %v", err)
+	}
+}
+
+func TestGluetunProvider_CachedHandlerDoesNotInspect(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newTestGluetunProvider(t, d)
+
+	if _, err := p.GetHandler(context.Background(), "kr", testGluetunExit("Korea")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	before := d.inspectCount()
+	for range 10 {
+		if _, err := p.GetHandler(context.Background(), "kr", testGluetunExit("Korea")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if n := d.inspectCount() - before; n != 0 {
+		t.Errorf("expected no inspect calls for cached handlers, got %d", n)
+	}
+}
+
+func TestGluetunProvider_UnhealthyExitIsRecovered(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newTestGluetunProvider(t, d, WithHealthInterval(10*time.Millisecond))
+
+	if _, err := p.GetHandler(context.Background(), "kr", testGluetunExit("Korea")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first := d.container("gluetun-kr")
+
+	d.setHealth("gluetun-kr", "unhealthy")
+
+	waitFor(t, func() bool {
+		c := d.container("gluetun-kr")
+		return c != nil && c.ID != first.ID
+	})
+
+	if n := d.createCount(); n != 2 {
+		t.Errorf("expected 2 containers to be created, got %d", n)
+	}
+
+	waitFor(t, func() bool {
+		_, err := p.GetHandler(context.Background(), "kr", testGluetunExit("Korea"))
+		return err == nil
+	})
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGluetunProvider_CrashedContainerIsInvalidated(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newTestGluetunProvider(t, d)
+
+	if _, err := p.GetHandler(context.Background(), "kr", testGluetunExit("Korea")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	d.crash("gluetun-kr")
+
+	waitFor(t, func() bool {
+		status, _ := p.ExitStatus(context.Background(), "kr", testGluetunExit("Korea"))
+		return status.State == StateStopped
+	})
+
+	if _, err := p.GetHandler(context.Background(), "kr", testGluetunExit("Korea")); err != nil {
+		t.Fatalf("expected exit to be recreated, got: %v", err)
+	}
+	if n := d.createCount(); n != 2 {
+		t.Errorf("expected 2 containers to be created, got %d", n)
+	}
+}
+
+func TestGluetunProvider_RestartsCrashedEagerExit(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newTestGluetunProvider(t, d)
+
+	exit := testGluetunExit("Korea")
+	exit.Eager = true
+	if err := p.StartExit(context.Background(), "kr", exit); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	d.crash("gluetun-kr")
+
+	// Restarted without waiting for a request
+	waitFor(t, func() bool { return d.createCount() == 2 && d.container("gluetun-kr") != nil })
+	waitFor(t, func() bool {
+		status, _ := p.ExitStatus(context.Background(), "kr", exit)
+		return status.State == StateRunning
+	})
+}
+
+func TestGluetunProvider_HealthStatusEventMarksExit(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newTestGluetunProvider(t, d)
+
+	if _, err := p.GetHandler(context.Background(), "kr", testGluetunExit("Korea")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	id := d.container("gluetun-kr").ID
+
+	d.emit(id, events.ActionHealthStatusUnhealthy)
+	waitFor(t, func() bool {
+		_, err := p.GetHandler(context.Background(), "kr", testGluetunExit("Korea"))
+		return err != nil
+	})
+
+	d.emit(id, events.ActionHealthStatusHealthy)
+	waitFor(t, func() bool {
+		_, err := p.GetHandler(context.Background(), "kr", testGluetunExit("Korea"))
+		return err == nil
+	})
+}
+
+func TestGluetunProvider_IdleExitIsReaped(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newTestGluetunProvider(t, d, WithHealthInterval(10*time.Millisecond))
+
+	exit := testGluetunExit("Korea")
+	exit.IdleTimeout = 50 * time.Millisecond
+
+	if _, err := p.GetHandler(context.Background(), "kr", exit); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	waitFor(t, func() bool { return d.container("gluetun-kr") == nil })
+
+	if status, _ := p.ExitStatus(context.Background(), "kr", exit); status.State != StateStopped {
+		t.Errorf("expected reaped exit to be stopped, got '%s'", status.State)
+	}
+
+	if _, err := p.GetHandler(context.Background(), "kr", exit); err != nil {
+		t.Fatalf("expected reaped exit to start again, got: %v", err)
+	}
+	if n := d.createCount(); n != 2 {
+		t.Errorf("expected 2 containers to be created, got %d", n)
+	}
+}
+
+func TestGluetunProvider_ActiveExitIsNotReaped(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newTestGluetunProvider(t, d, WithHealthInterval(10*time.Millisecond))
+
+	exit := testGluetunExit("Korea")
+	exit.IdleTimeout = 50 * time.Millisecond
+
+	if _, err := p.GetHandler(context.Background(), "kr", exit); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p.mu.Lock()
+	rt := p.runtimes["kr"]
+	p.mu.Unlock()
+
+	rt.active.Add(1)
+	time.Sleep(200 * time.Millisecond)
+
+	if d.container("gluetun-kr") == nil {
+		t.Fatal("expected exit with an active request not to be reaped")
+	}
+	rt.active.Add(-1)
+}
+
+func TestGluetunProvider_HandedOutExitIsNotReaped(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newTestGluetunProvider(t, d)
+
+	exit := testGluetunExit("Korea")
+	exit.IdleTimeout = 50 * time.Millisecond
+
+	if _, err := p.GetHandler(context.Background(), "kr", exit); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// The handler has been handed out but its request has not started yet
+	if _, err := p.GetHandler(context.Background(), "kr", exit); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p.reapIdle(time.Now())
+
+	if status, _ := p.ExitStatus(context.Background(), "kr", exit); status.State != StateRunning {
+		t.Errorf("expected handed out exit not to be reaped, got '%s'", status.State)
+	}
+}
+
+func TestGluetunProvider_UpdateExitAppliesIdleTimeout(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newTestGluetunProvider(t, d)
+
+	exit := testGluetunExit("Korea")
+	if _, err := p.GetHandler(context.Background(), "kr", exit); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	created := d.container("gluetun-kr")
+
+	exit.IdleTimeout = 50 * time.Millisecond
+	p.UpdateExit("kr", exit)
+
+	if c := d.container("gluetun-kr"); c == nil || c.ID != created.ID {
+		t.Fatal("expected update not to restart the container")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	p.reapIdle(time.Now())
+	waitFor(t, func() bool { return d.container("gluetun-kr") == nil })
+}
+
+func TestGluetunProvider_CloseStopsAllContainers(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newTestGluetunProvider(t, d)
+
+	for name, country := range map[string]string{"kr": "Korea", "uk": "United Kingdom"} {
+		if _, err := p.GetHandler(context.Background(), name, testGluetunExit(country)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, name := range []string{"gluetun-kr", "gluetun-uk"} {
+		if d.container(name) != nil {
+			t.Errorf("expected container '%s' to be stopped", name)
+		}
+	}
+	if status, _ := p.ExitStatus(context.Background(), "kr", testGluetunExit("Korea")); status.State != StateStopped {
+		t.Errorf("expected exit to be stopped after close, got '%s'", status.State)
+	}
+}
+
+func TestGluetunProvider_StopExitStopsBusyExitAfterDeadline(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newTestGluetunProvider(t, d)
+
+	if _, err := p.GetHandler(context.Background(), "kr", testGluetunExit("Korea")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A request that outlives the stop, like an open CONNECT tunnel
+	rt := memberRuntime(p, "kr")
+	rt.active.Add(1)
+	defer rt.active.Add(-1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := p.StopExit(ctx, "kr"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if d.container("gluetun-kr") != nil {
+		t.Error("expected container to be stopped once the drain deadline passed")
+	}
+}
+
+func TestGluetunProvider_ReapStopsExitThatDidNotDrain(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newTestGluetunProvider(t, d)
+
+	prev := drainTimeout
+	drainTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { drainTimeout = prev })
+
+	if _, err := p.GetHandler(context.Background(), "kr", testGluetunExit("Korea")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A request that raced the reaper and is still running when the drain times out
+	p.mu.Lock()
+	rt := p.runtimes["kr"]
+	delete(p.runtimes, "kr")
+	p.mu.Unlock()
+	rt.active.Add(1)
+	defer rt.active.Add(-1)
+
+	p.background.Add(1)
+	p.reapExit("kr", rt)
+
+	if d.container("gluetun-kr") != nil {
+		t.Error("expected container to be stopped after the drain timed out")
+	}
+}
+
+func TestGluetunProvider_LabelsContainers(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newTestGluetunProvider(t, d, WithOwnerID("test-owner"))
+
+	exit := testGluetunExit("Korea")
+	if _, err := p.GetHandler(context.Background(), "kr", exit); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	labels := d.container("gluetun-kr").Labels
+	if labels[labelOwner] != "test-owner" || labels[labelExit] != "kr" || labels[labelConfigHash] != p.configHash(exit) {
+		t.Errorf("unexpected labels: %v", labels)
+	}
+}
+
+func TestGluetunProvider_ReplacesStaleContainer(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newTestGluetunProvider(t, d)
+
+	stale := d.addContainer("gluetun-kr", map[string]string{
+		labelOwner:      "geoswitch",
+		labelExit:       "kr",
+		labelConfigHash: "outdated",
+	})
+
+	if _, err := p.GetHandler(context.Background(), "kr", testGluetunExit("Korea")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if c := d.container("gluetun-kr"); c == nil || c.ID == stale.ID {
+		t.Errorf("expected stale container to be replaced, got %+v", c)
+	}
+}
+
+func TestGluetunProvider_Reconcile(t *testing.T) {
+	d := newFakeDocker(t)
+	p := newTestGluetunProvider(t, d, WithOwnerID("test-owner"))
+
+	kr := testGluetunExit("Korea")
+	uk := testGluetunExit("United Kingdom")
+	cfg := &config.Config{
+		DefaultExit: "kr",
+		Exits:       map[string]config.ExitConfig{"kr": kr, "uk": uk},
+	}
+
+	current := d.addContainer("gluetun-kr", p.labels("kr", kr))
+	stale := d.addContainer("gluetun-uk", map[string]string{
+		labelOwner: "test-owner", labelExit: "uk", labelConfigHash: "outdated",
+	})
+	orphan := d.addContainer("gluetun-de", p.labels("de", testGluetunExit("Germany")))
+	foreign := d.addContainer("gluetun-fr", map[string]string{
+		labelOwner: "someone-else", labelExit: "fr", labelConfigHash: "outdated",
+	})
+
+	if err := p.Reconcile(context.Background(), cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if d.container(current.ID) == nil {
+		t.Error("expected matching container to be kept")
+	}
+	if d.container(stale.ID) != nil {
+		t.Error("expected stale container to be removed")
+	}
+	if d.container(orphan.ID) != nil {
+		t.Error("expected orphaned container to be removed")
+	}
+	if d.container(foreign.ID) == nil {
+		t.Error("expected container of another owner to be left alone")
+	}
+
+	status, _ := p.ExitStatus(context.Background(), "kr", kr)
+	if status.State != StateRunning || status.ContainerID != current.ID {
+		t.Errorf("expected 'kr' to be adopted, got %+v", status)
+	}
+
+	if _, err := p.GetHandler(context.Background(), "kr", kr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := d.createCount(); n != 0 {
+		t.Errorf("expected adopted exit not to create a container, got %d creates", n)
+	}
+}
+
+func TestGluetunProvider_MissingHealthcheckPolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		wantErr bool
+	}{
+		{policy: "", wantErr: true},
+		{policy: config.MissingHealthcheckFail, wantErr: true},
+		{policy: config.MissingHealthcheckAssumeHealthy, wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run("policy="+tt.policy, func(t *testing.T) {
+			d := newFakeDocker(t)
+			d.startHealth = ""
+			p := newTestGluetunProvider(t, d)
+
+			exit := testGluetunExit("Korea")
+			exit.MissingHealthcheck = tt.policy
+
+			_, err := p.GetHandler(context.Background(), "kr", exit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error: %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestGluetunProvider_StartupTimeout(t *testing.T) {
+	d := newFakeDocker(t)
+	d.startHealth = "starting"
+	p := newTestGluetunProvider(t, d)
+
+	exit := testGluetunExit("Korea")
+	exit.StartupTimeout = 100 * time.Millisecond
+	exit.HealthPollInterval = 10 * time.Millisecond
+
+	start := time.Now()
+	if _, err := p.GetHandler(context.Background(), "kr", exit); err == nil {
+		t.Fatal("expected startup to time out, got nil")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected startup to give up after its timeout, took %s", elapsed)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+
+	// Stands in for the container's HTTP proxy, which receives absolute-form requests
+	var gotURL atomic.Value
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotURL.Store(r.URL.String())
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer upstream.Close()
+
+	proxyURL, _ := url.Parse(upstream.URL)
+	transport := &http.Transport{Proxy: http.ProxyURL(proxyURL)}
+
+	if err := probe(context.Background(), transport, "http://example.com/ip"); err != nil {
+		t.Fatalf("expected probe to succeed, got: %v", err)
+	}
+	if got := gotURL.Load(); got != "http://example.com/ip" {
+		t.Errorf("expected probe to go through the proxy to http://example.com/ip, got %v", got)
+	}
+
+	status.Store(http.StatusBadGateway)
+	if err := probe(context.Background(), transport, "http://example.com/ip"); err == nil {
+		t.Error("expected probe to fail on a 502 response, got nil")
+	}
+}
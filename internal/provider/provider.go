@@ -3,6 +3,7 @@ package provider
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"geoswitch/internal/config"
 )
@@ -10,3 +11,68 @@ import (
 type ExitHandlerProvider interface {
 	GetHandler(ctx context.Context, exitName string, cfg config.ExitConfig) (http.Handler, error)
 }
+
+// ExitStopper is implemented by providers that hold per-exit resources which
+// should be released when an exit is removed from the configuration.
+type ExitStopper interface {
+	StopExit(ctx context.Context, exitName string) error
+}
+
+// ExitController is implemented by providers whose exits can be started,
+// stopped and restarted individually.
+type ExitController interface {
+	ExitStopper
+	StartExit(ctx context.Context, exitName string, cfg config.ExitConfig) error
+	RestartExit(ctx context.Context, exitName string, cfg config.ExitConfig) error
+}
+
+// ExitUpdater is implemented by providers that can apply settings such as
+// idle_timeout or balance to a running exit without restarting it.
+type ExitUpdater interface {
+	UpdateExit(exitName string, cfg config.ExitConfig)
+}
+
+// Runtime states reported in ExitStatus.
+const (
+	StateStopped  = "stopped"
+	StateStarting = "starting"
+	StateRunning  = "running"
+)
+
+// ExitStatus describes the runtime state of an exit as seen by its provider.
+// Fields that do not apply to a provider are left zero.
+type ExitStatus struct {
+	State         string
+	ContainerID   string
+	ContainerName string
+	Health        string
+	CreatedAt     time.Time
+	LastUsedAt    time.Time
+
+	// EgressIP and EgressCountry are the public address of the exit, if known.
+	EgressIP      string
+	EgressCountry string
+
+	// Members holds the status of each member of a pool exit, keyed by member name.
+	Members map[string]ExitStatus
+}
+
+type sessionKey struct{}
+
+// WithSession returns a copy of ctx carrying the session a client asked for.
+// Providers that spread requests over several egress points keep the requests
+// of a session on the same one while it stays available.
+func WithSession(ctx context.Context, session string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, session)
+}
+
+// sessionFrom returns the session carried by ctx, or "" if there is none.
+func sessionFrom(ctx context.Context) string {
+	session, _ := ctx.Value(sessionKey{}).(string)
+	return session
+}
+
+// StatusReporter is implemented by providers that can report per-exit runtime state.
+type StatusReporter interface {
+	ExitStatus(ctx context.Context, exitName string, cfg config.ExitConfig) (ExitStatus, bool)
+}
@@ -0,0 +1,147 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"geoswitch/internal/config"
+)
+
+// Registry is an ExitHandlerProvider that routes each exit to the provider
+// registered under its ExitConfig.Provider name.
+type Registry struct {
+	mu        sync.RWMutex
+	providers map[string]ExitHandlerProvider
+}
+
+// Register associates a provider implementation with a provider name,
+// replacing any provider previously registered under that name.
+func (r *Registry) Register(name string, p ExitHandlerProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log.Printf("[registry] registering provider '%s'", name)
+	r.providers[name] = p
+}
+
+// Lookup returns the provider registered under name.
+func (r *Registry) Lookup(name string) (ExitHandlerProvider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+func (r *Registry) GetHandler(
+	ctx context.Context,
+	exitName string,
+	cfg config.ExitConfig,
+) (http.Handler, error) {
+	p, ok := r.Lookup(cfg.Provider)
+	if !ok {
+		log.Printf("[registry] no provider registered for '%s' (exit '%s')", cfg.Provider, exitName)
+		return nil, fmt.Errorf("no provider registered for '%s'", cfg.Provider)
+	}
+	return p.GetHandler(ctx, exitName, cfg)
+}
+
+// ExitStatus forwards to the provider of cfg if it implements StatusReporter.
+func (r *Registry) ExitStatus(ctx context.Context, exitName string, cfg config.ExitConfig) (ExitStatus, bool) {
+	p, ok := r.Lookup(cfg.Provider)
+	if !ok {
+		return ExitStatus{}, false
+	}
+	s, ok := p.(StatusReporter)
+	if !ok {
+		return ExitStatus{}, false
+	}
+	return s.ExitStatus(ctx, exitName, cfg)
+}
+
+// StartExit starts exitName on the provider of cfg. Providers that do not
+// implement ExitController are started by requesting a handler.
+func (r *Registry) StartExit(ctx context.Context, exitName string, cfg config.ExitConfig) error {
+	p, ok := r.Lookup(cfg.Provider)
+	if !ok {
+		return fmt.Errorf("no provider registered for '%s'", cfg.Provider)
+	}
+	if c, ok := p.(ExitController); ok {
+		return c.StartExit(ctx, exitName, cfg)
+	}
+	_, err := p.GetHandler(ctx, exitName, cfg)
+	return err
+}
+
+// RestartExit restarts exitName on the provider of cfg. Providers that do not
+// implement ExitController are stopped, if they can be, and started again.
+func (r *Registry) RestartExit(ctx context.Context, exitName string, cfg config.ExitConfig) error {
+	p, ok := r.Lookup(cfg.Provider)
+	if !ok {
+		return fmt.Errorf("no provider registered for '%s'", cfg.Provider)
+	}
+	if c, ok := p.(ExitController); ok {
+		return c.RestartExit(ctx, exitName, cfg)
+	}
+	if s, ok := p.(ExitStopper); ok {
+		if err := s.StopExit(ctx, exitName); err != nil {
+			return err
+		}
+	}
+	_, err := p.GetHandler(ctx, exitName, cfg)
+	return err
+}
+
+// UpdateExit forwards to the provider of cfg if it implements ExitUpdater.
+func (r *Registry) UpdateExit(exitName string, cfg config.ExitConfig) {
+	p, ok := r.Lookup(cfg.Provider)
+	if !ok {
+		return
+	}
+	if u, ok := p.(ExitUpdater); ok {
+		u.UpdateExit(exitName, cfg)
+	}
+}
+
+// StopExit forwards to every registered provider that implements ExitStopper.
+func (r *Registry) StopExit(ctx context.Context, exitName string) error {
+	var errs []error
+	for _, p := range r.snapshot() {
+		if s, ok := p.(ExitStopper); ok {
+			errs = append(errs, s.StopExit(ctx, exitName))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every registered provider that holds resources.
+func (r *Registry) Close(ctx context.Context) error {
+	var errs []error
+	for _, p := range r.snapshot() {
+		if c, ok := p.(interface{ Close(context.Context) error }); ok {
+			errs = append(errs, c.Close(ctx))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Registry) snapshot() []ExitHandlerProvider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	providers := make([]ExitHandlerProvider, 0, len(r.providers))
+	for _, p := range r.providers {
+		providers = append(providers, p)
+	}
+	return providers
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		providers: make(map[string]ExitHandlerProvider),
+	}
+}
@@ -0,0 +1,45 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"geoswitch/internal/config"
+)
+
+func TestRegistry_GetHandler_RoutesByProvider(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("first", NewStaticProvider(map[string]http.Handler{
+		"kr": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("first"))
+		}),
+	}))
+	registry.Register("second", NewStaticProvider(map[string]http.Handler{
+		"kr": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("second"))
+		}),
+	}))
+
+	h, err := registry.GetHandler(context.Background(), "kr", config.ExitConfig{Provider: "second"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if body := w.Body.String(); body != "second" {
+		t.Errorf("expected body 'second', got '%s'", body)
+	}
+}
+
+func TestRegistry_GetHandler_UnknownProvider(t *testing.T) {
+	registry := NewRegistry()
+
+	_, err := registry.GetHandler(context.Background(), "kr", config.ExitConfig{Provider: "missing"})
+	if err == nil {
+		t.Fatal("expected error for unregistered provider, got nil")
+	}
+}
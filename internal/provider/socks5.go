@@ -0,0 +1,58 @@
+package provider
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"geoswitch/internal/config"
+	"geoswitch/internal/proxy"
+)
+
+// SOCKS5Provider serves exits through a SOCKS5 server, such as Tor or an
+// SSH dynamic forward.
+type SOCKS5Provider struct {
+	cache exitCache
+}
+
+func (p *SOCKS5Provider) GetHandler(
+	_ context.Context,
+	exitName string,
+	cfg config.ExitConfig,
+) (http.Handler, error) {
+	return p.cache.get(exitName, cfg, func() (http.Handler, *http.Transport, error) {
+		log.Printf("[socks5] creating handler for exit '%s' via %s (remote_dns=%t)", exitName, cfg.Address, cfg.RemoteDNS)
+
+		dialer := &proxy.SOCKS5Dialer{
+			Address:   cfg.Address,
+			Username:  cfg.Username,
+			Password:  cfg.Password,
+			RemoteDNS: cfg.RemoteDNS,
+			Forward: &net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			},
+		}
+
+		transport := newTransport(dialer.DialContext)
+		handler := proxy.NewConnectHandler(proxy.NewReverseProxy(proxy.WithTransport(transport)), dialer.DialContext)
+		return handler, transport, nil
+	})
+}
+
+func (p *SOCKS5Provider) ExitStatus(_ context.Context, exitName string, _ config.ExitConfig) (ExitStatus, bool) {
+	return p.cache.status(exitName), true
+}
+
+// StopExit drops the cached handler for exitName and closes its idle connections.
+func (p *SOCKS5Provider) StopExit(_ context.Context, exitName string) error {
+	p.cache.remove(exitName)
+	return nil
+}
+
+func NewSOCKS5Provider() *SOCKS5Provider {
+	log.Printf("[socks5] initializing SOCKS5Provider")
+	return &SOCKS5Provider{}
+}
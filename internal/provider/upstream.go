@@ -0,0 +1,97 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"geoswitch/internal/config"
+	"geoswitch/internal/proxy"
+)
+
+// UpstreamProxyProvider serves exits through an upstream HTTP or HTTPS proxy,
+// such as a commercial proxy service. Unlike GluetunProvider it manages no
+// containers; it only points a transport at the configured proxy URL.
+type UpstreamProxyProvider struct {
+	cache exitCache
+}
+
+func (p *UpstreamProxyProvider) GetHandler(
+	_ context.Context,
+	exitName string,
+	cfg config.ExitConfig,
+) (http.Handler, error) {
+	return p.cache.get(exitName, cfg, func() (http.Handler, *http.Transport, error) {
+		proxyURL, err := upstreamProxyURL(cfg)
+		if err != nil {
+			log.Printf("[upstream] invalid proxy settings for exit '%s': %v", exitName, err)
+			return nil, nil, err
+		}
+
+		log.Printf("[upstream] creating handler for exit '%s' via %s", exitName, proxyURL.Redacted())
+
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}
+
+		// Credentials in the proxy URL are sent as Proxy-Authorization,
+		// both on plain requests and on CONNECT for https targets and tunnels
+		transport := newTransport(dialer.DialContext)
+		transport.Proxy = http.ProxyURL(proxyURL)
+		tunnel := &proxy.HTTPConnectDialer{ProxyURL: proxyURL, Forward: dialer}
+
+		handler := proxy.NewConnectHandler(proxy.NewReverseProxy(proxy.WithTransport(transport)), tunnel.DialContext)
+		return handler, transport, nil
+	})
+}
+
+func (p *UpstreamProxyProvider) ExitStatus(_ context.Context, exitName string, _ config.ExitConfig) (ExitStatus, bool) {
+	return p.cache.status(exitName), true
+}
+
+// StopExit drops the cached handler for exitName and closes its idle connections.
+func (p *UpstreamProxyProvider) StopExit(_ context.Context, exitName string) error {
+	p.cache.remove(exitName)
+	return nil
+}
+
+func NewUpstreamProxyProvider() *UpstreamProxyProvider {
+	log.Printf("[upstream] initializing UpstreamProxyProvider")
+	return &UpstreamProxyProvider{}
+}
+
+// upstreamProxyURL builds the proxy URL for an exit, applying the configured
+// credentials. Explicit username/password settings take precedence over
+// credentials embedded in the URL.
+func upstreamProxyURL(cfg config.ExitConfig) (*url.URL, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url")
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("proxy url must be an absolute http or https URL")
+	}
+
+	password := cfg.Password
+	username := cfg.Username
+	if username == "" && u.User != nil {
+		username = u.User.Username()
+	}
+	if password == "" && u.User != nil {
+		password, _ = u.User.Password()
+	}
+
+	switch {
+	case password != "":
+		u.User = url.UserPassword(username, password)
+	case username != "":
+		u.User = url.User(username)
+	}
+
+	return u, nil
+}
@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"geoswitch/internal/config"
+)
+
+// newFakeUpstreamProxy returns a server acting as an HTTP proxy that records the
+// Proxy-Authorization header and the absolute URL of each request.
+func newFakeUpstreamProxy(t *testing.T, gotAuth, gotURL *string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*gotAuth = r.Header.Get("Proxy-Authorization")
+		*gotURL = r.URL.String()
+		_, _ = w.Write([]byte("via upstream"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func serveThrough(t *testing.T, h http.Handler, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.RequestURI = ""
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestUpstreamProxyProvider_SendsProxyAuthorization(t *testing.T) {
+	var gotAuth, gotURL string
+	upstream := newFakeUpstreamProxy(t, &gotAuth, &gotURL)
+
+	p := NewUpstreamProxyProvider()
+
+	h, err := p.GetHandler(context.Background(), "commercial", config.ExitConfig{
+		Provider: "http",
+		Country:  "DE",
+		URL:      upstream.URL,
+		Username: "alice",
+		Password: "s3cret",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	w := serveThrough(t, h, "http://example.com/path")
+
+	if body := w.Body.String(); body != "via upstream" {
+		t.Errorf("expected body 'via upstream', got '%s'", body)
+	}
+
+	if gotURL != "http://example.com/path" {
+		t.Errorf("expected proxied URL 'http://example.com/path', got '%s'", gotURL)
+	}
+
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:s3cret"))
+	if gotAuth != expected {
+		t.Errorf("expected Proxy-Authorization '%s', got '%s'", expected, gotAuth)
+	}
+}
+
+func TestUpstreamProxyProvider_InvalidURL(t *testing.T) {
+	p := NewUpstreamProxyProvider()
+
+	_, err := p.GetHandler(context.Background(), "commercial", config.ExitConfig{
+		Provider: "http",
+		Country:  "DE",
+		URL:      "proxy.example.com:3128",
+	})
+	if err == nil {
+		t.Fatal("expected error for invalid proxy url, got nil")
+	}
+}
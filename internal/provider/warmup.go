@@ -0,0 +1,196 @@
+package provider
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"geoswitch/internal/config"
+)
+
+// WarmupStatus is the progress of starting a single eager exit.
+type WarmupStatus struct {
+	State    string // StateStarting until the exit is ready, then StateRunning
+	Attempts int
+	Err      error // error of the last failed attempt, if any
+}
+
+// Warmup starts the exits flagged as eager ahead of the first request and
+// tracks whether all of them are ready. Once started, an exit only counts as
+// ready while its provider, if it is a StatusReporter, reports it serving.
+type Warmup struct {
+	ctx  context.Context
+	ctrl ExitController
+
+	mu      sync.Mutex
+	exits   map[string]WarmupStatus
+	configs map[string]config.ExitConfig
+	cancels map[string]context.CancelFunc
+}
+
+// errNotServing is reported for an eager exit that started but stopped serving since.
+var errNotServing = errors.New("exit stopped serving")
+
+// warmupRetryMin and warmupRetryMax bound the delay between attempts to start an eager exit.
+var (
+	warmupRetryMin = 5 * time.Second
+	warmupRetryMax = time.Minute
+)
+
+// StartWarmup starts every eager exit of cfg in parallel through ctrl and
+// returns immediately. Exits that fail to start are retried with backoff until
+// they succeed or ctx is cancelled.
+func StartWarmup(ctx context.Context, ctrl ExitController, cfg *config.Config) *Warmup {
+	w := &Warmup{
+		ctx:     ctx,
+		ctrl:    ctrl,
+		exits:   make(map[string]WarmupStatus),
+		configs: make(map[string]config.ExitConfig),
+		cancels: make(map[string]context.CancelFunc),
+	}
+
+	var names []string
+	for name, exit := range cfg.Exits {
+		if exit.Eager {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	if len(names) > 0 {
+		log.Printf("[warmup] starting %d eager exits: %v", len(names), names)
+	}
+	for _, name := range names {
+		w.Warm(name, cfg.Exits[name])
+	}
+	return w
+}
+
+// Warm starts a single eager exit, e.g. one added or changed by a config reload,
+// replacing any warm-up of the exit still in progress. The exit counts towards
+// readiness until it has started.
+func (w *Warmup) Warm(name string, exit config.ExitConfig) {
+	ctx, cancel := context.WithCancel(w.ctx)
+
+	w.mu.Lock()
+	if prev, ok := w.cancels[name]; ok {
+		prev()
+	}
+	w.cancels[name] = cancel
+	w.exits[name] = WarmupStatus{State: StateStarting}
+	w.configs[name] = exit
+	w.mu.Unlock()
+
+	go w.run(ctx, name, exit)
+}
+
+// Forget stops tracking an exit that is no longer eager or no longer configured.
+func (w *Warmup) Forget(name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if cancel, ok := w.cancels[name]; ok {
+		cancel()
+	}
+	delete(w.cancels, name)
+	delete(w.exits, name)
+	delete(w.configs, name)
+}
+
+func (w *Warmup) run(ctx context.Context, name string, exit config.ExitConfig) {
+	backoff := warmupRetryMin
+	for attempt := 1; ; attempt++ {
+		started := time.Now()
+		err := w.ctrl.StartExit(ctx, name, exit)
+
+		w.mu.Lock()
+		if ctx.Err() != nil {
+			// Replaced by a newer warm-up, forgotten or shutting down
+			w.mu.Unlock()
+			return
+		}
+		status := WarmupStatus{State: StateStarting, Attempts: attempt, Err: err}
+		if err == nil {
+			status.State = StateRunning
+		}
+		w.exits[name] = status
+		w.mu.Unlock()
+
+		if err == nil {
+			log.Printf("[warmup] exit '%s' ready after %s", name, time.Since(started).Round(time.Millisecond))
+			if w.Ready() {
+				log.Printf("[warmup] all eager exits are ready")
+			}
+			return
+		}
+
+		log.Printf("[warmup] failed to start exit '%s' (attempt %d), retrying in %s: %v", name, attempt, backoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, warmupRetryMax)
+	}
+}
+
+// Ready reports whether every eager exit has started and is still serving.
+func (w *Warmup) Ready() bool {
+	for _, status := range w.Status() {
+		if status.State != StateRunning {
+			return false
+		}
+	}
+	return true
+}
+
+// Status returns a snapshot of the warm-up progress of each eager exit.
+// Exits that started but are no longer serving are reported as starting.
+func (w *Warmup) Status() map[string]WarmupStatus {
+	w.mu.Lock()
+	statuses := make(map[string]WarmupStatus, len(w.exits))
+	configs := make(map[string]config.ExitConfig, len(w.configs))
+	for name, status := range w.exits {
+		statuses[name] = status
+		configs[name] = w.configs[name]
+	}
+	w.mu.Unlock()
+
+	// Providers are asked outside the lock, as they may take their own locks
+	for name, status := range statuses {
+		if status.State == StateRunning && !w.serving(name, configs[name]) {
+			statuses[name] = WarmupStatus{State: StateStarting, Attempts: status.Attempts, Err: errNotServing}
+		}
+	}
+	return statuses
+}
+
+// serving reports whether a started exit is still serving according to the
+// current status from its provider. Exits without a status are taken to be
+// serving once started.
+func (w *Warmup) serving(name string, exit config.ExitConfig) bool {
+	reporter, ok := w.ctrl.(StatusReporter)
+	if !ok {
+		return true
+	}
+	status, ok := reporter.ExitStatus(w.ctx, name, exit)
+	if !ok {
+		return true
+	}
+
+	if len(status.Members) == 0 {
+		return status.State == StateRunning && (status.Health == "" || status.Health == healthHealthy || status.Health == healthRunning)
+	}
+
+	serving := 0
+	for _, member := range status.Members {
+		if member.State == StateRunning && (member.Health == healthHealthy || member.Health == healthRunning) {
+			serving++
+		}
+	}
+	return serving >= cmp.Or(exit.MinReady, len(status.Members))
+}
@@ -0,0 +1,141 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"geoswitch/internal/config"
+)
+
+// fakeController starts exits after a configurable number of failures.
+type fakeController struct {
+	mu       sync.Mutex
+	failures map[string]int
+	started  []string
+}
+
+func (f *fakeController) StartExit(_ context.Context, exitName string, _ config.ExitConfig) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failures[exitName] > 0 {
+		f.failures[exitName]--
+		return errors.New("container failed health check")
+	}
+	f.started = append(f.started, exitName)
+	return nil
+}
+
+func (f *fakeController) StopExit(context.Context, string) error { return nil }
+
+func (f *fakeController) RestartExit(context.Context, string, config.ExitConfig) error { return nil }
+
+func TestWarmup_StartsOnlyEagerExits(t *testing.T) {
+	ctrl := &fakeController{}
+	cfg := &config.Config{
+		DefaultExit: "kr",
+		Exits: map[string]config.ExitConfig{
+			"kr": {Provider: "direct", Country: "Korea", Eager: true},
+			"uk": {Provider: "direct", Country: "United Kingdom"},
+		},
+	}
+
+	w := StartWarmup(t.Context(), ctrl, cfg)
+	waitFor(t, w.Ready)
+
+	status := w.Status()
+	if len(status) != 1 || status["kr"].State != StateRunning {
+		t.Fatalf("expected only 'kr' to be warmed up, got %+v", status)
+	}
+
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+	if len(ctrl.started) != 1 || ctrl.started[0] != "kr" {
+		t.Errorf("expected 'kr' to be started, got %v", ctrl.started)
+	}
+}
+
+func TestWarmup_RetriesFailedExits(t *testing.T) {
+	defer func(retryMin, retryMax time.Duration) { warmupRetryMin, warmupRetryMax = retryMin, retryMax }(warmupRetryMin, warmupRetryMax)
+	warmupRetryMin, warmupRetryMax = 10*time.Millisecond, 20*time.Millisecond
+
+	ctrl := &fakeController{failures: map[string]int{"kr": 2}}
+	cfg := &config.Config{
+		DefaultExit: "kr",
+		Exits: map[string]config.ExitConfig{
+			"kr": {Provider: "direct", Country: "Korea", Eager: true},
+		},
+	}
+
+	w := StartWarmup(t.Context(), ctrl, cfg)
+	waitFor(t, w.Ready)
+
+	if status := w.Status()["kr"]; status.Attempts != 3 || status.Err != nil {
+		t.Errorf("expected success on attempt 3, got %+v", status)
+	}
+}
+
+func TestWarmup_NotReadyUntilStarted(t *testing.T) {
+	ctrl := &fakeController{failures: map[string]int{"kr": 1}}
+	cfg := &config.Config{
+		DefaultExit: "kr",
+		Exits: map[string]config.ExitConfig{
+			"kr": {Provider: "direct", Country: "Korea", Eager: true},
+		},
+	}
+
+	w := StartWarmup(t.Context(), ctrl, cfg)
+	waitFor(t, func() bool { return w.Status()["kr"].Err != nil })
+
+	if w.Ready() {
+		t.Error("expected warm-up not to be ready while an eager exit is failing")
+	}
+
+	w.Forget("kr")
+	if !w.Ready() {
+		t.Error("expected warm-up to be ready once the failing exit is forgotten")
+	}
+}
+
+// reportingController is a fakeController whose exits report a settable state.
+type reportingController struct {
+	fakeController
+	state atomic.Value // string
+}
+
+func (c *reportingController) ExitStatus(context.Context, string, config.ExitConfig) (ExitStatus, bool) {
+	state, _ := c.state.Load().(string)
+	return ExitStatus{State: state, Health: healthHealthy}, true
+}
+
+func TestWarmup_NotReadyWhileExitIsDown(t *testing.T) {
+	ctrl := &reportingController{}
+	ctrl.state.Store(StateRunning)
+	cfg := &config.Config{
+		DefaultExit: "kr",
+		Exits: map[string]config.ExitConfig{
+			"kr": {Provider: "gluetun", Country: "Korea", Eager: true},
+		},
+	}
+
+	w := StartWarmup(t.Context(), ctrl, cfg)
+	waitFor(t, w.Ready)
+
+	// The container went away after the warm-up finished
+	ctrl.state.Store(StateStopped)
+	if w.Ready() {
+		t.Error("expected not to be ready while an eager exit is down")
+	}
+	if status := w.Status()["kr"]; status.State != StateStarting || status.Err == nil {
+		t.Errorf("expected exit to be reported as starting with an error, got %+v", status)
+	}
+
+	ctrl.state.Store(StateRunning)
+	if !w.Ready() {
+		t.Error("expected to be ready once the exit is back")
+	}
+}
@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// HTTPConnectDialer dials TCP connections through an HTTP proxy by issuing
+// CONNECT requests, as used to tunnel through Gluetun's HTTP proxy or an
+// upstream proxy service.
+type HTTPConnectDialer struct {
+	// ProxyURL is the http or https URL of the proxy. Credentials in it are
+	// sent as a Basic Proxy-Authorization header.
+	ProxyURL *url.URL
+
+	// Forward dials the proxy itself. Defaults to a zero net.Dialer.
+	Forward *net.Dialer
+}
+
+// DialContext connects to addr through the proxy.
+// Only TCP networks are supported.
+func (d *HTTPConnectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("http connect: unsupported network %s", network)
+	}
+
+	forward := d.Forward
+	if forward == nil {
+		forward = &net.Dialer{}
+	}
+
+	proxyAddr := d.ProxyURL.Host
+	if d.ProxyURL.Port() == "" {
+		port := "80"
+		if d.ProxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(d.ProxyURL.Hostname(), port)
+	}
+
+	raw, err := forward.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("http connect: failed to reach proxy %s: %w", proxyAddr, err)
+	}
+
+	// Abort the handshake if ctx is cancelled while we wait on the proxy.
+	// Closing raw also closes any TLS or buffered connection wrapping it.
+	stop := context.AfterFunc(ctx, func() { raw.Close() })
+	conn, err := d.handshake(ctx, raw, addr)
+	if !stop() {
+		raw.Close()
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (d *HTTPConnectDialer) handshake(ctx context.Context, conn net.Conn, addr string) (net.Conn, error) {
+	if d.ProxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: d.ProxyURL.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return conn, fmt.Errorf("http connect: TLS handshake with proxy failed: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u := d.ProxyURL.User; u != nil {
+		password, _ := u.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	if err := req.Write(conn); err != nil {
+		return conn, fmt.Errorf("http connect: failed to send CONNECT: %w", err)
+	}
+
+	br := bufio.NewReader(conn)
+	// The body is left unread: on success the connection is the tunnel, and on
+	// failure it is closed
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return conn, fmt.Errorf("http connect: failed to read CONNECT response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return conn, fmt.Errorf("http connect: proxy refused CONNECT to %s: %s", addr, resp.Status)
+	}
+
+	// Keep anything the proxy sent past the response headers
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a net.Conn whose reads are served from r first.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// CloseWrite half-closes the underlying connection if it supports it.
+func (c *bufferedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newFakeConnectProxy returns an HTTP proxy that tunnels CONNECT requests,
+// requiring the given credentials when username is set.
+func newFakeConnectProxy(t *testing.T, username, password string) *url.URL {
+	t.Helper()
+
+	tunnel := NewConnectHandler(http.NotFoundHandler(), (&net.Dialer{}).DialContext)
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username != "" && r.Header.Get("Proxy-Authorization") != want {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		tunnel.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	u, _ := url.Parse(server.URL)
+	if username != "" {
+		u.User = url.UserPassword(username, password)
+	}
+	return u
+}
+
+func TestHTTPConnectDialer_TunnelsThroughProxy(t *testing.T) {
+	backend := newEchoBackend(t)
+	dialer := &HTTPConnectDialer{ProxyURL: newFakeConnectProxy(t, "alice", "s3cret")}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", backend)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("ping"))
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("failed to read through tunnel: %v", err)
+	}
+	if string(buf) != "ping" {
+		t.Errorf("expected 'ping' echoed back, got '%s'", buf)
+	}
+}
+
+func TestHTTPConnectDialer_ProxyRefuses(t *testing.T) {
+	backend := newEchoBackend(t)
+	proxyURL := newFakeConnectProxy(t, "alice", "s3cret")
+	proxyURL.User = url.UserPassword("alice", "wrong")
+
+	dialer := &HTTPConnectDialer{ProxyURL: proxyURL}
+
+	_, err := dialer.DialContext(context.Background(), "tcp", backend)
+	if err == nil {
+		t.Fatal("expected error for refused CONNECT, got nil")
+	}
+	if !strings.Contains(err.Error(), "407") {
+		t.Errorf("expected error to report status 407, got: %v", err)
+	}
+}
+
+func TestHTTPConnectDialer_UnsupportedNetwork(t *testing.T) {
+	dialer := &HTTPConnectDialer{ProxyURL: &url.URL{Scheme: "http", Host: "127.0.0.1:1"}}
+
+	if _, err := dialer.DialContext(context.Background(), "udp", "example.com:53"); err == nil {
+		t.Fatal("expected error for udp, got nil")
+	}
+}
+
+func TestHTTPConnectDialer_CancelledDuringHandshake(t *testing.T) {
+	// A proxy that accepts connections but never answers the CONNECT
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(io.Discard, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	dialer := &HTTPConnectDialer{ProxyURL: &url.URL{Scheme: "http", Host: ln.Addr().String()}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := dialer.DialContext(ctx, "tcp", "example.com:443"); err == nil {
+		t.Fatal("expected error once ctx expired, got nil")
+	}
+}
@@ -0,0 +1,235 @@
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+const (
+	socks5Version = 0x05
+
+	socks5AuthNone         = 0x00
+	socks5AuthPassword     = 0x02
+	socks5AuthNoAcceptable = 0xff
+
+	socks5CmdConnect = 0x01
+
+	socks5AddrIPv4   = 0x01
+	socks5AddrDomain = 0x03
+	socks5AddrIPv6   = 0x04
+)
+
+var socks5Replies = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// SOCKS5Dialer dials TCP connections through a SOCKS5 server (RFC 1928),
+// optionally authenticating with a username and password (RFC 1929).
+type SOCKS5Dialer struct {
+	// Address is the host:port of the SOCKS5 server.
+	Address string
+
+	// Username and Password enable username/password authentication when Username is set.
+	Username string
+	Password string
+
+	// RemoteDNS sends hostnames to the server for resolution instead of
+	// resolving them locally. Tor requires this to avoid DNS leaks.
+	RemoteDNS bool
+
+	// Forward dials the SOCKS5 server itself. Defaults to a zero net.Dialer.
+	Forward *net.Dialer
+}
+
+// DialContext connects to addr through the SOCKS5 server.
+// Only TCP networks are supported.
+func (d *SOCKS5Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("socks5: unsupported network %s", network)
+	}
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("socks5: invalid address %s: %w", addr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("socks5: invalid port in %s", addr)
+	}
+
+	if !d.RemoteDNS && net.ParseIP(host) == nil {
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+		if err != nil {
+			return nil, fmt.Errorf("socks5: failed to resolve %s: %w", host, err)
+		}
+		host = preferIPv4(ips).String()
+	}
+
+	forward := d.Forward
+	if forward == nil {
+		forward = &net.Dialer{}
+	}
+
+	conn, err := forward.DialContext(ctx, "tcp", d.Address)
+	if err != nil {
+		return nil, fmt.Errorf("socks5: failed to reach server %s: %w", d.Address, err)
+	}
+
+	// Abort the handshake if ctx is cancelled while we wait on the server
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	err = d.handshake(conn, host, port)
+	if !stop() {
+		conn.Close()
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (d *SOCKS5Dialer) handshake(conn net.Conn, host string, port int) error {
+	methods := []byte{socks5AuthNone}
+	if d.Username != "" {
+		methods = []byte{socks5AuthPassword}
+	}
+
+	greeting := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return fmt.Errorf("socks5: failed to send greeting: %w", err)
+	}
+
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return fmt.Errorf("socks5: failed to read method selection: %w", err)
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("socks5: unexpected protocol version %d", reply[0])
+	}
+
+	switch reply[1] {
+	case socks5AuthNone:
+	case socks5AuthPassword:
+		if err := d.authenticate(conn); err != nil {
+			return err
+		}
+	case socks5AuthNoAcceptable:
+		return errors.New("socks5: server accepted none of the offered authentication methods")
+	default:
+		return fmt.Errorf("socks5: server selected unsupported authentication method %d", reply[1])
+	}
+
+	return connect(conn, host, port)
+}
+
+func (d *SOCKS5Dialer) authenticate(conn net.Conn) error {
+	if d.Username == "" {
+		return errors.New("socks5: server requires authentication but no username is configured")
+	}
+	if len(d.Username) > 255 || len(d.Password) > 255 {
+		return errors.New("socks5: username or password too long")
+	}
+
+	req := []byte{0x01, byte(len(d.Username))}
+	req = append(req, d.Username...)
+	req = append(req, byte(len(d.Password)))
+	req = append(req, d.Password...)
+
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("socks5: failed to send credentials: %w", err)
+	}
+
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return fmt.Errorf("socks5: failed to read authentication reply: %w", err)
+	}
+	if reply[1] != 0x00 {
+		return errors.New("socks5: authentication failed")
+	}
+	return nil
+}
+
+// connect issues a CONNECT command for host:port and consumes the server's reply.
+func connect(conn net.Conn, host string, port int) error {
+	req := []byte{socks5Version, socks5CmdConnect, 0x00}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			req = append(req, socks5AddrIPv4)
+			req = append(req, ip4...)
+		} else {
+			req = append(req, socks5AddrIPv6)
+			req = append(req, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("socks5: hostname too long: %s", host)
+		}
+		req = append(req, socks5AddrDomain, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("socks5: failed to send connect request: %w", err)
+	}
+
+	var header [4]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return fmt.Errorf("socks5: failed to read connect reply: %w", err)
+	}
+	if header[1] != 0x00 {
+		msg, ok := socks5Replies[header[1]]
+		if !ok {
+			msg = fmt.Sprintf("unknown error %d", header[1])
+		}
+		return fmt.Errorf("socks5: connect to %s failed: %s", net.JoinHostPort(host, strconv.Itoa(port)), msg)
+	}
+
+	// Skip the bound address, which we have no use for
+	var skip int
+	switch header[3] {
+	case socks5AddrIPv4:
+		skip = net.IPv4len
+	case socks5AddrIPv6:
+		skip = net.IPv6len
+	case socks5AddrDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return fmt.Errorf("socks5: failed to read bound address: %w", err)
+		}
+		skip = int(n[0])
+	default:
+		return fmt.Errorf("socks5: unexpected bound address type %d", header[3])
+	}
+
+	if _, err := io.CopyN(io.Discard, conn, int64(skip+2)); err != nil {
+		return fmt.Errorf("socks5: failed to read bound address: %w", err)
+	}
+	return nil
+}
+
+func preferIPv4(ips []net.IP) net.IP {
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip
+		}
+	}
+	return ips[0]
+}
@@ -0,0 +1,232 @@
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// fakeSOCKS5Server is a minimal in-process SOCKS5 server. Every CONNECT is
+// forwarded to backend, whatever address the client asked for, and the
+// requested address is recorded.
+type fakeSOCKS5Server struct {
+	listener net.Listener
+	backend  string
+	username string
+	password string
+
+	requested chan string
+}
+
+func newFakeSOCKS5Server(t *testing.T, backend, username, password string) *fakeSOCKS5Server {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	s := &fakeSOCKS5Server{
+		listener:  l,
+		backend:   backend,
+		username:  username,
+		password:  password,
+		requested: make(chan string, 16),
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeSOCKS5Server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	var header [2]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+
+	if s.username != "" {
+		conn.Write([]byte{0x05, 0x02})
+
+		var ver [2]byte
+		io.ReadFull(conn, ver[:])
+		user := make([]byte, ver[1])
+		io.ReadFull(conn, user)
+		var plen [1]byte
+		io.ReadFull(conn, plen[:])
+		pass := make([]byte, plen[0])
+		io.ReadFull(conn, pass)
+
+		if string(user) != s.username || string(pass) != s.password {
+			conn.Write([]byte{0x01, 0x01})
+			return
+		}
+		conn.Write([]byte{0x01, 0x00})
+	} else {
+		conn.Write([]byte{0x05, 0x00})
+	}
+
+	var req [4]byte
+	if _, err := io.ReadFull(conn, req[:]); err != nil {
+		return
+	}
+
+	var host string
+	switch req[3] {
+	case 0x01:
+		ip := make([]byte, 4)
+		io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case 0x04:
+		ip := make([]byte, 16)
+		io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case 0x03:
+		var n [1]byte
+		io.ReadFull(conn, n[:])
+		name := make([]byte, n[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	}
+	var port [2]byte
+	io.ReadFull(conn, port[:])
+
+	s.requested <- net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:]))))
+
+	upstream, err := net.Dial("tcp", s.backend)
+	if err != nil {
+		conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+
+	conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 127, 0, 0, 1, 0, 0})
+
+	go io.Copy(upstream, conn)
+	io.Copy(conn, upstream)
+}
+
+func newSOCKS5Backend(t *testing.T) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("via socks5"))
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+func getThroughDialer(t *testing.T, dialer *SOCKS5Dialer, target string) string {
+	t.Helper()
+
+	client := &http.Client{
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+	}
+
+	resp, err := client.Get(target)
+	if err != nil {
+		t.Fatalf("request through socks5 failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestSOCKS5Dialer_RemoteDNSSendsHostname(t *testing.T) {
+	backend := newSOCKS5Backend(t)
+	server := newFakeSOCKS5Server(t, backend.Listener.Addr().String(), "", "")
+
+	dialer := &SOCKS5Dialer{
+		Address:   server.listener.Addr().String(),
+		RemoteDNS: true,
+	}
+
+	body := getThroughDialer(t, dialer, "http://example.invalid:8080/")
+
+	if body != "via socks5" {
+		t.Errorf("expected body 'via socks5', got '%s'", body)
+	}
+
+	if got := <-server.requested; got != "example.invalid:8080" {
+		t.Errorf("expected server to receive 'example.invalid:8080', got '%s'", got)
+	}
+}
+
+func TestSOCKS5Dialer_LocalDNSSendsIP(t *testing.T) {
+	backend := newSOCKS5Backend(t)
+	server := newFakeSOCKS5Server(t, backend.Listener.Addr().String(), "", "")
+
+	dialer := &SOCKS5Dialer{
+		Address: server.listener.Addr().String(),
+	}
+
+	getThroughDialer(t, dialer, "http://localhost:8080/")
+
+	got := <-server.requested
+	host, _, _ := net.SplitHostPort(got)
+	if net.ParseIP(host) == nil {
+		t.Errorf("expected server to receive an IP address, got '%s'", got)
+	}
+}
+
+func TestSOCKS5Dialer_UsernamePassword(t *testing.T) {
+	backend := newSOCKS5Backend(t)
+	server := newFakeSOCKS5Server(t, backend.Listener.Addr().String(), "alice", "s3cret")
+
+	dialer := &SOCKS5Dialer{
+		Address:   server.listener.Addr().String(),
+		Username:  "alice",
+		Password:  "s3cret",
+		RemoteDNS: true,
+	}
+
+	if body := getThroughDialer(t, dialer, "http://example.invalid/"); body != "via socks5" {
+		t.Errorf("expected body 'via socks5', got '%s'", body)
+	}
+}
+
+func TestSOCKS5Dialer_WrongPassword(t *testing.T) {
+	backend := newSOCKS5Backend(t)
+	server := newFakeSOCKS5Server(t, backend.Listener.Addr().String(), "alice", "s3cret")
+
+	dialer := &SOCKS5Dialer{
+		Address:   server.listener.Addr().String(),
+		Username:  "alice",
+		Password:  "wrong",
+		RemoteDNS: true,
+	}
+
+	_, err := dialer.DialContext(context.Background(), "tcp", "example.invalid:80")
+	if err == nil {
+		t.Fatal("expected authentication error, got nil")
+	}
+}
+
+func TestSOCKS5Dialer_UnsupportedNetwork(t *testing.T) {
+	dialer := &SOCKS5Dialer{Address: "127.0.0.1:1080"}
+
+	_, err := dialer.DialContext(context.Background(), "udp", "example.invalid:53")
+	if err == nil {
+		t.Fatal("expected error for udp network, got nil")
+	}
+}
@@ -0,0 +1,218 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DialFunc dials addr on the named network, like net.Dialer.DialContext.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// TunnelOption is a functional option for configuring a CONNECT tunnel handler.
+type TunnelOption func(*tunnelConfig)
+
+type tunnelConfig struct {
+	dialTimeout time.Duration
+	idleTimeout time.Duration
+}
+
+// WithDialTimeout bounds how long opening the connection to the target may take.
+func WithDialTimeout(d time.Duration) TunnelOption {
+	return func(c *tunnelConfig) {
+		c.dialTimeout = d
+	}
+}
+
+// WithIdleTimeout closes tunnels on which no bytes moved in either direction for d.
+func WithIdleTimeout(d time.Duration) TunnelOption {
+	return func(c *tunnelConfig) {
+		c.idleTimeout = d
+	}
+}
+
+// NewConnectHandler returns a handler that serves CONNECT requests by dialling
+// the request's host through dial and splicing the client connection to it,
+// and passes every other request on to next. The request's Host must be the
+// host:port to connect to.
+//
+// Headers set on the ResponseWriter before ServeHTTP is called are sent with
+// the 200 response that opens the tunnel.
+//
+// Options can be provided to customize the tunnel behavior:
+//   - WithDialTimeout: Limit the time to reach the target (default: 30s)
+//   - WithIdleTimeout: Close idle tunnels after the given duration (default: 5m)
+func NewConnectHandler(next http.Handler, dial DialFunc, opts ...TunnelOption) http.Handler {
+	config := &tunnelConfig{
+		dialTimeout: 30 * time.Second,
+		idleTimeout: 5 * time.Minute,
+	}
+
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	return &connectHandler{next: next, dial: dial, config: *config}
+}
+
+type connectHandler struct {
+	next   http.Handler
+	dial   DialFunc
+	config tunnelConfig
+}
+
+func (h *connectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	h.serveConnect(w, r)
+}
+
+func (h *connectHandler) serveConnect(w http.ResponseWriter, r *http.Request) {
+	addr := r.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		http.Error(w, "CONNECT target must be host:port", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.config.dialTimeout)
+	upstream, err := h.dial(ctx, "tcp", addr)
+	cancel()
+	if err != nil {
+		log.Printf("[tunnel] failed to connect to %s: %v", addr, err)
+		http.Error(w, "Failed to reach target", http.StatusBadGateway)
+		return
+	}
+
+	client, buffered, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		upstream.Close()
+		log.Printf("[tunnel] cannot take over connection for %s: %v", addr, err)
+		http.Error(w, "Tunnelling not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// The 200 response is written by hand as the connection is no longer managed by net/http
+	_, err = io.WriteString(buffered, "HTTP/1.1 200 Connection established\r\n")
+	if err == nil {
+		err = w.Header().Write(buffered)
+	}
+	if err == nil {
+		_, err = io.WriteString(buffered, "\r\n")
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		client.Close()
+		upstream.Close()
+		log.Printf("[tunnel] failed to open tunnel to %s: %v", addr, err)
+		return
+	}
+
+	// Bytes the client sent along with the CONNECT request, typically a TLS ClientHello
+	early := buffered.Reader.Buffered()
+	if early > 0 {
+		data, _ := buffered.Reader.Peek(early)
+		if _, err := upstream.Write(data); err != nil {
+			client.Close()
+			upstream.Close()
+			log.Printf("[tunnel] failed to forward to %s: %v", addr, err)
+			return
+		}
+	}
+
+	log.Printf("[tunnel] tunnel to %s opened for %s", addr, r.RemoteAddr)
+	started := time.Now()
+	sent, received := splice(client, upstream, h.config.idleTimeout)
+	log.Printf("[tunnel] tunnel to %s closed after %s (%d bytes sent, %d received)",
+		addr, time.Since(started).Round(time.Millisecond), int64(early)+sent, received)
+}
+
+// splice copies bytes between client and upstream in both directions until
+// both sides are done or the tunnel has been idle for idleTimeout, then closes
+// both connections. It returns the bytes sent to and received from upstream.
+func splice(client, upstream net.Conn, idleTimeout time.Duration) (sent, received int64) {
+	t := &tunnel{idleTimeout: idleTimeout}
+	t.touch()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		sent = t.pipe(upstream, client)
+	}()
+	go func() {
+		defer wg.Done()
+		received = t.pipe(client, upstream)
+	}()
+	wg.Wait()
+
+	client.Close()
+	upstream.Close()
+	return sent, received
+}
+
+// tunnel tracks activity across both directions, so a direction waiting on a
+// long download is not considered idle.
+type tunnel struct {
+	idleTimeout time.Duration
+	lastActive  atomic.Int64
+}
+
+func (t *tunnel) touch() {
+	t.lastActive.Store(time.Now().UnixNano())
+}
+
+func (t *tunnel) idle() bool {
+	return time.Since(time.Unix(0, t.lastActive.Load())) >= t.idleTimeout
+}
+
+// pipe copies from src to dst. When src is done, dst is half-closed so the
+// peer sees the end of the stream while the other direction carries on. On
+// errors and idle timeouts both connections are closed, ending the other
+// direction as well.
+func (t *tunnel) pipe(dst, src net.Conn) int64 {
+	var written int64
+	buf := make([]byte, 32<<10)
+
+	for {
+		src.SetReadDeadline(time.Now().Add(t.idleTimeout))
+		n, err := src.Read(buf)
+		if n > 0 {
+			t.touch()
+			dst.SetWriteDeadline(time.Now().Add(t.idleTimeout))
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				src.Close()
+				dst.Close()
+				return written
+			}
+			written += int64(n)
+		}
+
+		switch {
+		case err == nil:
+		case errors.Is(err, os.ErrDeadlineExceeded) && !t.idle():
+			// The other direction is still active
+		case errors.Is(err, io.EOF):
+			if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+				cw.CloseWrite()
+			} else {
+				dst.Close()
+			}
+			return written
+		default:
+			src.Close()
+			dst.Close()
+			return written
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newEchoBackend returns the address of a TCP server that echoes everything
+// it reads and closes the connection when the client is done writing.
+func newEchoBackend(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+// newTunnelServer returns a server tunnelling CONNECT requests directly to
+// their target, answering other requests with "next".
+func newTunnelServer(t *testing.T, opts ...TunnelOption) *httptest.Server {
+	t.Helper()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("next"))
+	})
+	h := NewConnectHandler(next, (&net.Dialer{}).DialContext, opts...)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test-Exit", "direct")
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// openTunnel sends CONNECT addr to server and returns the connection and the response.
+func openTunnel(t *testing.T, server *httptest.Server, addr string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to reach tunnel server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	req, _ := http.NewRequest(http.MethodConnect, "http://"+addr, nil)
+	req.Host = addr
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("failed to send CONNECT: %v", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatalf("failed to read CONNECT response: %v", err)
+	}
+	return conn, br, resp
+}
+
+func TestNewConnectHandler_TunnelsBothWays(t *testing.T) {
+	backend := newEchoBackend(t)
+	server := newTunnelServer(t)
+
+	conn, br, resp := openTunnel(t, server, backend)
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	if got := resp.Header.Get("X-Test-Exit"); got != "direct" {
+		t.Errorf("expected headers set before the tunnel opened to be sent, got '%s'", got)
+	}
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("failed to write through tunnel: %v", err)
+	}
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		t.Fatalf("failed to read through tunnel: %v", err)
+	}
+	if string(buf) != "ping" {
+		t.Errorf("expected 'ping' echoed back, got '%s'", buf)
+	}
+}
+
+func TestNewConnectHandler_HalfClose(t *testing.T) {
+	backend := newEchoBackend(t)
+	server := newTunnelServer(t)
+
+	conn, br, _ := openTunnel(t, server, backend)
+
+	conn.Write([]byte("last words"))
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatalf("failed to half-close: %v", err)
+	}
+
+	// The backend still answers after the client is done writing, then closes
+	body, err := io.ReadAll(br)
+	if err != nil {
+		t.Fatalf("failed to read through tunnel: %v", err)
+	}
+	if string(body) != "last words" {
+		t.Errorf("expected 'last words' echoed back, got '%s'", body)
+	}
+}
+
+func TestNewConnectHandler_IdleTimeout(t *testing.T) {
+	backend := newEchoBackend(t)
+	server := newTunnelServer(t, WithIdleTimeout(100*time.Millisecond))
+
+	conn, br, resp := openTunnel(t, server, backend)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Errorf("expected idle tunnel to be closed, got %v", err)
+	}
+}
+
+func TestNewConnectHandler_UnreachableTarget(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	closed := l.Addr().String()
+	l.Close()
+
+	server := newTunnelServer(t)
+	_, _, resp := openTunnel(t, server, closed)
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("expected status %d, got %d", http.StatusBadGateway, resp.StatusCode)
+	}
+}
+
+func TestNewConnectHandler_PassesOtherRequests(t *testing.T) {
+	server := newTunnelServer(t)
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "next" {
+		t.Errorf("expected body 'next', got '%s'", body)
+	}
+}